@@ -1,79 +1,351 @@
 package main
 
 import (
+	"context"
+	"reflect"
 	"sort"
+	"sync"
 	"time"
 
+	"github.com/juju/errors"
 	"github.com/sirupsen/logrus"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/classify"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/clusters"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/config"
 	"github.com/thxcode/kubernetes-event-exporter/pkg/events"
 	"github.com/thxcode/kubernetes-event-exporter/pkg/events/sinks"
 	"github.com/thxcode/kubernetes-event-exporter/pkg/events/sinks/pipes"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/expressions"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/limits"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/routes"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/streams"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/transforms"
 	"github.com/thxcode/kubernetes-event-exporter/pkg/utils/logger"
 	"github.com/thxcode/kubernetes-event-exporter/pkg/watchers"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 )
 
+const streamPipeName = "stream"
+
+type eventExporterConfig struct {
+	ResyncPeriod    time.Duration
+	StorageTTL      time.Duration
+	PipesParallel   bool
+	Hub             *streams.Hub
+	ShutdownTimeout time.Duration
+}
+
+// eventExporterPipes represents the reloadable part of the exporter configuration.
+type eventExporterPipes struct {
+	Pipes      []config.PipeConfig
+	DropRules  []*streams.Filter
+	Transforms *transforms.Chain
+	Classifier *classify.Classifier
+	Routes     *routes.Table
+	// Limits creates the limiter of each cluster, as the limiter keeps the states of the events.
+	Limits *limits.Config
+}
+
 type eventExporter struct {
 	logContext logrus.Fields
 
-	watcher watchers.Watcher
-	sink    sinks.Sink
+	cluster         *clusters.Cluster
+	kclient         kubernetes.Interface
+	dclient         dynamic.Interface
+	watcher         watchers.Watcher
+	sink            *sinks.DefaultSink
+	hub             *streams.Hub
+	shutdownTimeout time.Duration
+
+	pipeConfigs  map[string]config.PipeConfig
+	pipes        map[string]sinks.Pipe
+	limitsConfig *limits.Config
+	limiter      *limits.Limiter
 }
 
-func (e *eventExporter) Run(stopCh <-chan struct{}) {
-	if err := e.sink.Run(stopCh); err != nil {
-		logrus.WithFields(e.logContext).WithError(err).Fatalln("fail to run sink")
+func (e *eventExporter) start() error {
+	if err := e.sink.Start(); err != nil {
+		return errors.Annotate(err, "fail to run sink")
+	}
+	// forget the skipped pipes, so that they are created again on reloading
+	for name := range e.pipes {
+		if !e.sink.Has(name) {
+			delete(e.pipes, name)
+			delete(e.pipeConfigs, name)
+		}
+	}
+
+	if e.hub != nil {
+		e.hub.RegisterStore(e.cluster.Name, e.watcher.GetStore(), e.sink.View)
 	}
 
+	return nil
+}
+
+func (e *eventExporter) watch(stopCh <-chan struct{}) {
 	logrus.WithFields(e.logContext).Debugln("starting")
 	e.watcher.Run(stopCh)
+}
+
+func (e *eventExporter) stop() error {
+	if e.hub != nil {
+		e.hub.UnregisterStore(e.cluster.Name)
+	}
+
+	// the watcher has stopped, so no more events reach the sink while draining
+	logrus.WithFields(e.logContext).Debugf("stopping, draining pipes within %s", e.shutdownTimeout)
+	ctx, cancelFunc := context.WithTimeout(context.Background(), e.shutdownTimeout)
+	defer cancelFunc()
+	dropped := e.sink.Stop(ctx)
 	logrus.WithFields(e.logContext).Debugln("stopped")
+
+	if dropped != 0 {
+		return errors.Errorf("dropped %d events on stopping", dropped)
+	}
+	return nil
+}
+
+// exporterReload is the reloading prepared by an exporter, the new pipes have started,
+// and it's either committed or aborted.
+type exporterReload struct {
+	e           *eventExporter
+	ep          *eventExporterPipes
+	pipeConfigs map[string]config.PipeConfig
+	pipes       map[string]sinks.Pipe
+	started     []sinks.Pipe
+	limiter     *limits.Limiter
+}
+
+// commit replaces the pipes without restarting the watcher, the removed pipes are stopped.
+func (r *exporterReload) commit() {
+	e := r.e
+
+	ctx, cancelFunc := context.WithTimeout(context.Background(), e.shutdownTimeout)
+	defer cancelFunc()
+	e.sink.Reload(ctx, r.pipes, r.ep.DropRules, r.ep.Transforms, r.ep.Classifier, r.ep.Routes, r.limiter)
+
+	e.pipeConfigs = r.pipeConfigs
+	e.pipes = r.pipes
+	e.limitsConfig = r.ep.Limits
+	e.limiter = r.limiter
 }
 
-func newEventExporter(kclient kubernetes.Interface, khost string, resyncPeriod time.Duration, storageTTL time.Duration, usePipes []string, pipesParallel bool) *eventExporter {
-	if len(usePipes) == 0 {
-		logrus.Fatalln("failed to create sink, there aren't any pipes enabled")
+// abort stops the started pipes, the exporter keeps the previous pipes.
+func (r *exporterReload) abort() {
+	r.e.discardPipes(r.started)
+}
+
+// prepareReload keeps the pipes whose configuration is unchanged, and creates and starts
+// the others, a scoped pipe which fails is left out.
+func (e *eventExporter) prepareReload(ep *eventExporterPipes) (_ *exporterReload, err error) {
+	var created []sinks.Pipe
+	defer func() {
+		if err != nil {
+			e.discardPipes(created)
+		}
+	}()
+
+	pipeConfigs := make(map[string]config.PipeConfig, len(ep.Pipes))
+	ps := make(map[string]sinks.Pipe, len(ep.Pipes)+1)
+	optionalPipes := make(map[string]struct{})
+	for _, pipeConfig := range ep.Pipes {
+		if pipe, ok := e.pipes[pipeConfig.Name]; ok && reflect.DeepEqual(e.pipeConfigs[pipeConfig.Name], pipeConfig) {
+			pipeConfigs[pipeConfig.Name] = pipeConfig
+			ps[pipeConfig.Name] = pipe
+			continue
+		}
+
+		pipe, err := e.newPipe(pipeConfig)
+		if err != nil {
+			return nil, err
+		}
+		if pipe != nil {
+			created = append(created, pipe)
+			pipeConfigs[pipeConfig.Name] = pipeConfig
+			ps[pipeConfig.Name] = pipe
+			if pipeConfig.Scoped {
+				optionalPipes[pipeConfig.Name] = struct{}{}
+			}
+		}
+	}
+	if pipe, ok := e.pipes[streamPipeName]; ok {
+		ps[streamPipeName] = pipe
 	}
 
-	usePipeSet := make(map[string]struct{}, len(usePipes))
-	for _, usePipe := range usePipes {
-		if _, ok := usePipeSet[usePipe]; !ok {
-			usePipeSet[usePipe] = struct{}{}
+	// keep the states of the limited events if the limits are unchanged
+	limiter := e.limiter
+	if !reflect.DeepEqual(e.limitsConfig, ep.Limits) {
+		if limiter, err = limits.NewLimiter(ep.Limits); err != nil {
+			return nil, err
 		}
 	}
 
-	distinctUsePipe := make([]string, 0, len(usePipeSet))
-	for p := range usePipeSet {
-		distinctUsePipe = append(distinctUsePipe, p)
+	// the sink stops the created pipes if the starting fails
+	ctx, cancelFunc := context.WithTimeout(context.Background(), e.shutdownTimeout)
+	defer cancelFunc()
+	prepared, err := e.sink.Prepare(ctx, ps, optionalPipes)
+	if err != nil {
+		created = nil
+		return nil, err
 	}
-	sort.Strings(distinctUsePipe)
 
-	ps := make([]sinks.Pipe, 0, len(distinctUsePipe))
-	for _, usePipe := range distinctUsePipe {
-		switch usePipe {
-		case "logger":
-			if logrus.GetLevel() == logrus.DebugLevel {
-				ps = append(ps, pipes.NewLogger(khost))
+	r := &exporterReload{
+		e:           e,
+		ep:          ep,
+		pipeConfigs: make(map[string]config.PipeConfig, len(prepared)),
+		pipes:       prepared,
+		limiter:     limiter,
+	}
+	for name := range prepared {
+		if pipeConfig, ok := pipeConfigs[name]; ok {
+			r.pipeConfigs[name] = pipeConfig
+		}
+	}
+	for _, pipe := range created {
+		for _, preparedPipe := range prepared {
+			if pipe == preparedPipe {
+				r.started = append(r.started, pipe)
+				break
 			}
-		case "mongodb":
-			ps = append(ps, pipes.NewMongoDB(khost, kclient))
 		}
 	}
+	return r, nil
+}
+
+// reload applies the pipes to the exporter alone.
+func (e *eventExporter) reload(ep *eventExporterPipes) error {
+	r, err := e.prepareReload(ep)
+	if err != nil {
+		return err
+	}
+
+	r.commit()
+	return nil
+}
+
+// discardPipes stops the pipes which are created but not taken by the sink.
+func (e *eventExporter) discardPipes(ps []sinks.Pipe) {
+	ctx, cancelFunc := context.WithTimeout(context.Background(), e.shutdownTimeout)
+	defer cancelFunc()
+
+	for _, pipe := range ps {
+		pipe.Stop(ctx)
+	}
+}
+
+func newEventExporter(cluster *clusters.Cluster, exporterConfig *eventExporterConfig, ep *eventExporterPipes) (*eventExporter, error) {
+	kclient, err := kubernetes.NewForConfig(cluster.Config)
+	if err != nil {
+		return nil, errors.Annotatef(err, "failed to create Kubernetes client for %s", cluster.Config.Host)
+	}
+	dclient, err := dynamic.NewForConfig(cluster.Config)
+	if err != nil {
+		return nil, errors.Annotatef(err, "failed to create Kubernetes dynamic client for %s", cluster.Config.Host)
+	}
+
+	e := &eventExporter{
+		logContext:      logger.CreateLogContext("EXPORTER", cluster.Name),
+		cluster:         cluster,
+		kclient:         kclient,
+		dclient:         dclient,
+		hub:             exporterConfig.Hub,
+		shutdownTimeout: exporterConfig.ShutdownTimeout,
+		pipeConfigs:     make(map[string]config.PipeConfig, len(ep.Pipes)),
+		pipes:           make(map[string]sinks.Pipe, len(ep.Pipes)+1),
+	}
 
-	sink, err := sinks.NewDefaultSink(&sinks.DefaultSinkConfig{
-		KubernetesHost: khost,
-		Pipes:          ps,
-		PipesParallel:  pipesParallel,
+	optionalPipes := make(map[string]struct{})
+	for _, pipeConfig := range ep.Pipes {
+		pipe, err := e.newPipe(pipeConfig)
+		if err != nil {
+			return nil, err
+		}
+		if pipe != nil {
+			e.pipeConfigs[pipeConfig.Name] = pipeConfig
+			e.pipes[pipeConfig.Name] = pipe
+			if pipeConfig.Scoped {
+				optionalPipes[pipeConfig.Name] = struct{}{}
+			}
+		}
+	}
+	if exporterConfig.Hub != nil {
+		e.pipes[streamPipeName] = pipes.NewStream(cluster.Name, exporterConfig.Hub)
+	}
+
+	e.limitsConfig = ep.Limits
+	if e.limiter, err = limits.NewLimiter(ep.Limits); err != nil {
+		return nil, err
+	}
+
+	// the sink owns a copy, as the pipes of the exporter are replaced on reloading
+	sinkPipes := make(map[string]sinks.Pipe, len(e.pipes))
+	for name, pipe := range e.pipes {
+		sinkPipes[name] = pipe
+	}
+
+	e.sink, err = sinks.NewDefaultSink(&sinks.DefaultSinkConfig{
+		ClusterName:   cluster.Name,
+		Pipes:         sinkPipes,
+		PipesParallel: exporterConfig.PipesParallel,
+		OptionalPipes: optionalPipes,
+		DropRules:     ep.DropRules,
+		Transforms:    ep.Transforms,
+		Classifier:    ep.Classifier,
+		Routes:        ep.Routes,
+		Limiter:       e.limiter,
+		Enricher:      expressions.NewNamespaceEnricher(e.logContext, kclient),
 	})
 	if err != nil {
-		logrus.WithError(err).Fatalf("failed to create sink")
+		return nil, errors.Annotate(err, "failed to create sink")
 	}
+	e.watcher = createWatcher(kclient, e.sink, exporterConfig.ResyncPeriod, exporterConfig.StorageTTL)
 
-	return &eventExporter{
-		logContext: logger.CreateLogContext("EXPORTER", khost),
-		watcher:    createWatcher(kclient, sink, resyncPeriod, storageTTL),
-		sink:       sink,
+	return e, nil
+}
+
+// newPipe creates the pipe of the configuration, a scoped pipe is skipped if it can't be
+// created, and by the sink if it can't start, so that a broken resource of a namespace
+// owner never fails the others.
+func (e *eventExporter) newPipe(pipeConfig config.PipeConfig) (sinks.Pipe, error) {
+	pipe, err := createPipe(pipeConfig, e.cluster, e.kclient, e.dclient)
+	if err != nil && pipeConfig.Scoped {
+		logrus.WithFields(e.logContext).WithError(err).Warnf("skipping pipe %s", pipeConfig.Name)
+		return nil, nil
 	}
+
+	return pipe, err
+}
+
+// pipeOptions returns the options of the pipe, which only fall back to the envs if allowed.
+func pipeOptions(pipeConfig config.PipeConfig) pipes.Options {
+	if pipeConfig.Envs {
+		return pipes.NewEnvOptions(pipeConfig.Options)
+	}
+
+	return pipes.Options(pipeConfig.Options)
+}
+
+func createPipe(pipeConfig config.PipeConfig, cluster *clusters.Cluster, kclient kubernetes.Interface, dclient dynamic.Interface) (sinks.Pipe, error) {
+	options := pipeOptions(pipeConfig)
+
+	switch pipeConfig.Type {
+	case "logger":
+		if logrus.GetLevel() == logrus.DebugLevel {
+			return pipes.NewLogger(pipeConfig.Name, cluster.Name, options), nil
+		}
+		return nil, nil
+	case "mongodb":
+		return pipes.NewMongoDB(pipeConfig.Name, cluster.Name, cluster.Config.Host, kclient, dclient, options), nil
+	case "syslog":
+		return pipes.NewSyslog(pipeConfig.Name, cluster.Name, options), nil
+	case "nats":
+		return pipes.NewNats(pipeConfig.Name, cluster.Name, options), nil
+	case "cloudevents":
+		return pipes.NewCloudEvents(pipeConfig.Name, cluster.Name, options), nil
+	}
+
+	return nil, errors.Errorf("unknown type %s of pipe %s", pipeConfig.Type, pipeConfig.Name)
 }
 
 func createWatcher(client kubernetes.Interface, sink sinks.Sink, resyncPeriod time.Duration, storageTTL time.Duration) watchers.Watcher {
@@ -84,3 +356,96 @@ func createWatcher(client kubernetes.Interface, sink sinks.Sink, resyncPeriod ti
 		Handler:      sink,
 	})
 }
+
+// eventExporters runs an exporter for each cluster, and reloads the pipes
+// of the running exporters.
+type eventExporters struct {
+	logContext logrus.Fields
+
+	config *eventExporterConfig
+
+	pipes      *eventExporterPipes
+	generation int
+	running    map[string]*eventExporter
+	sync.Mutex
+}
+
+// Run is the clusters.RunFunc of the registry.
+func (es *eventExporters) Run(cluster *clusters.Cluster, started func(), stopCh <-chan struct{}) error {
+	es.Lock()
+	ep, generation := es.pipes, es.generation
+	es.Unlock()
+
+	e, err := newEventExporter(cluster, es.config, ep)
+	if err != nil {
+		return err
+	}
+	if err := e.start(); err != nil {
+		return err
+	}
+
+	es.Lock()
+	// the pipes may be reloaded during starting, the cluster is restarted
+	// with the latest pipes if it can't apply them
+	if es.generation != generation {
+		if err := e.reload(es.pipes); err != nil {
+			es.Unlock()
+			e.stop()
+			return errors.Annotate(err, "failed to apply the reloaded pipes")
+		}
+	}
+	es.running[cluster.Name] = e
+	es.Unlock()
+	started()
+
+	e.watch(stopCh)
+
+	es.Lock()
+	delete(es.running, cluster.Name)
+	es.Unlock()
+
+	return e.stop()
+}
+
+// Reload applies the pipes to all running exporters and the later started ones, or to none:
+// each exporter prepares the new pipes first, and they are committed only if all exporters
+// have prepared, otherwise the prepared pipes are stopped and the previous ones keep working.
+func (es *eventExporters) Reload(ep *eventExporterPipes) error {
+	es.Lock()
+	defer es.Unlock()
+
+	names := make([]string, 0, len(es.running))
+	for name := range es.running {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	prepared := make([]*exporterReload, 0, len(names))
+	for _, name := range names {
+		r, err := es.running[name].prepareReload(ep)
+		if err != nil {
+			for _, r := range prepared {
+				r.abort()
+			}
+			return errors.Annotatef(err, "failed to reload cluster %s", name)
+		}
+		prepared = append(prepared, r)
+	}
+	for _, r := range prepared {
+		r.commit()
+	}
+
+	es.pipes = ep
+	es.generation++
+	return nil
+}
+
+func newEventExporters(config *eventExporterConfig, ep *eventExporterPipes) *eventExporters {
+	return &eventExporters{
+		logContext: logger.CreateLogContext("EXPORTERS", ""),
+
+		config:  config,
+		pipes:   ep,
+		running: make(map[string]*eventExporter),
+	}
+}
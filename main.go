@@ -4,17 +4,28 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"sort"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/classify"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/clusters"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/config"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/crds"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/encoding"
 	"github.com/thxcode/kubernetes-event-exporter/pkg/events/sinks/pipes"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/routes"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/servers/rest"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/servers/rpc"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/streams"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/transforms"
 	"github.com/thxcode/kubernetes-event-exporter/pkg/utils/logger"
 	"github.com/urfave/cli"
-	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/clientcmd"
 
 	"github.com/prometheus/common/version"
 
@@ -24,12 +35,16 @@ import (
 func newSystemStopChannel() chan struct{} {
 	ch := make(chan struct{})
 	go func() {
-		c := make(chan os.Signal)
-		signal.Notify(c, os.Interrupt, os.Kill)
+		c := make(chan os.Signal, 2)
+		signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 		sig := <-c
-		logrus.Debugf("recieved signal %s, terminating", sig.String())
+		logrus.Infof("received signal %s, terminating", sig.String())
 
 		close(ch)
+
+		sig = <-c
+		logrus.Warnf("received signal %s again, exiting without draining", sig.String())
+		os.Exit(1)
 	}()
 
 	return ch
@@ -67,14 +82,99 @@ func main() {
 	app.Version = version.Print("kubernetes-event-exporter")
 	app.Usage = "An exporter exposes events of Kubernetes."
 	app.Action = appAction
+	app.Commands = []cli.Command{replayCommand}
 
 	app.Flags = []cli.Flag{
+		cli.StringFlag{
+			Name:   "config",
+			Usage:  "configuration file of clusters, pipes, drop rules, transforms, classification, routes, tenants and limits, reloaded on SIGHUP or when it changes",
+			EnvVar: "CONFIG",
+		},
+		cli.DurationFlag{
+			Name:   "config-reload-period",
+			Usage:  "period for checking the configuration file changes, 0 means only reloading on SIGHUP",
+			EnvVar: "CONFIG_RELOAD_PERIOD",
+			Value:  10 * time.Second,
+		},
 		cli.StringSliceFlag{
 			Name:   "kubeconfig",
 			Usage:  "kube config for accessing Kubernetes cluster",
 			EnvVar: "KUBECONFIG",
 			Value:  &cli.StringSlice{},
 		},
+		cli.StringSliceFlag{
+			Name:   "kube-context",
+			Usage:  "contexts of the kube configs to use, blank means the current context, \"*\" means every context",
+			EnvVar: "KUBE_CONTEXT",
+			Value:  &cli.StringSlice{},
+		},
+		cli.StringFlag{
+			Name:   "kubeconfig-dir",
+			Usage:  "directory of kube configs, the clusters are added or removed at runtime when the files change",
+			EnvVar: "KUBECONFIG_DIR",
+		},
+		cli.DurationFlag{
+			Name:   "kubeconfig-dir-period",
+			Usage:  "period for rescanning the kube config directory",
+			EnvVar: "KUBECONFIG_DIR_PERIOD",
+			Value:  30 * time.Second,
+		},
+		cli.StringSliceFlag{
+			Name:   "cluster-alias",
+			Usage:  "human-friendly name of a cluster in form of <context>=<name>, the cluster is named by its context by default",
+			EnvVar: "CLUSTER_ALIAS",
+			Value:  &cli.StringSlice{},
+		},
+		cli.StringFlag{
+			Name:   "cluster-secret-selector",
+			Usage:  "label selector of the Secrets which register clusters at runtime, blank means disabled",
+			EnvVar: "CLUSTER_SECRET_SELECTOR",
+		},
+		cli.StringFlag{
+			Name:   "cluster-secret-namespace",
+			Usage:  "namespace of the Secrets which register clusters, blank means the namespace of the exporter",
+			EnvVar: "CLUSTER_SECRET_NAMESPACE",
+		},
+		cli.BoolFlag{
+			Name:   "crd-watch",
+			Usage:  "watch the EventExporterPipe and EventRoute resources of the in-cluster, so that the namespace owners route their own events at runtime",
+			EnvVar: "CRD_WATCH",
+		},
+		cli.StringFlag{
+			Name:   "crd-pipe-types",
+			Usage:  "comma separated types of the pipes allowed to the EventExporterPipe resources",
+			EnvVar: "CRD_PIPE_TYPES",
+			Value:  "cloudevents,nats,syslog",
+		},
+		cli.StringFlag{
+			Name:   "in-cluster-name",
+			Usage:  "name of the cluster which the exporter is running in, used without any kube configs or configured clusters",
+			EnvVar: "IN_CLUSTER_NAME",
+			Value:  "local",
+		},
+		cli.BoolFlag{
+			Name:   "skip-in-cluster",
+			Usage:  "don't export the events of the cluster which the exporter is running in, e.g. when all clusters are registered by --kubeconfig-dir or --cluster-secret-selector",
+			EnvVar: "SKIP_IN_CLUSTER",
+		},
+		cli.DurationFlag{
+			Name:   "restart-backoff",
+			Usage:  "initial backoff for restarting a failed cluster, doubled on each failure",
+			EnvVar: "RESTART_BACKOFF",
+			Value:  1 * time.Second,
+		},
+		cli.DurationFlag{
+			Name:   "restart-backoff-max",
+			Usage:  "maximum backoff for restarting a failed cluster",
+			EnvVar: "RESTART_BACKOFF_MAX",
+			Value:  5 * time.Minute,
+		},
+		cli.DurationFlag{
+			Name:   "shutdown-timeout",
+			Usage:  "deadline for draining the queued events of each cluster on shutdown, the remaining events are dropped",
+			EnvVar: "SHUTDOWN_TIMEOUT",
+			Value:  30 * time.Second,
+		},
 		cli.StringFlag{
 			Name:   "log-level",
 			Usage:  "log level for logurs",
@@ -102,9 +202,28 @@ func main() {
 		cli.StringSliceFlag{
 			Name: "use-pipe",
 			Usage: fmt.Sprintf(`pipes for sink using:
-			1. [logger] pipe is DEBUG logrus;
-			2. [mongodb] pipe uses %s, %s and %s envs`,
-				pipes.MongodbConnectURIEnvKey, pipes.MongodbDatabaseNameEnvKey, pipes.MongodbEnableJsonAttachEnvKey),
+			1. [logger] pipe is DEBUG logrus, uses %s env;
+			2. [mongodb] pipe uses %s envs;
+			3. [syslog] pipe uses %s, %s, %s, %s, %s, %s and %s envs;
+			4. [nats] pipe uses %s, %s, %s, %s and %s envs;
+			5. [cloudevents] pipe uses %s, %s, %s, %s, %s and %s envs;
+			an env with "_FILE" suffix, e.g. %s_FILE, reads the value from a file;
+			an encoding env, e.g. %s, chooses one of %s encoders, with "_TEMPLATE" suffixed env for the template encoder`,
+				pipes.LoggerEncodingEnvKey,
+				strings.Join([]string{
+					pipes.MongodbConnectURIEnvKey, pipes.MongodbDatabaseNameEnvKey, pipes.MongodbEnableJsonAttachEnvKey, pipes.MongodbEnableLifecycleEnvKey,
+					pipes.MongodbIncludedKindsEnvKey, pipes.MongodbExcludedKindsEnvKey, pipes.MongodbEnableAttachEnvKey,
+					pipes.MongodbRetentionEnvKey, pipes.MongodbRetentionFieldEnvKey, pipes.MongodbCollectionTypeEnvKey, pipes.MongodbCappedSizeEnvKey, pipes.MongodbCappedMaxDocumentsEnvKey,
+					pipes.MongodbUsernameEnvKey, pipes.MongodbPasswordEnvKey, pipes.MongodbAuthSourceEnvKey, pipes.MongodbAuthMechanismEnvKey,
+					pipes.MongodbTLSCAFileEnvKey, pipes.MongodbTLSCertKeyFileEnvKey, pipes.MongodbTLSInsecureSkipVerifyEnvKey,
+					pipes.MongodbWriteConcernEnvKey, pipes.MongodbWriteTimeoutEnvKey, pipes.MongodbJournalEnvKey, pipes.MongodbReadPreferenceEnvKey,
+					pipes.MongodbMaxPoolSizeEnvKey, pipes.MongodbConnectTimeoutEnvKey, pipes.MongodbServerSelectionTimeoutEnvKey, pipes.MongodbOperationTimeoutEnvKey,
+				}, ", "),
+				pipes.SyslogNetworkEnvKey, pipes.SyslogAddressEnvKey, pipes.SyslogFacilityEnvKey, pipes.SyslogAppNameEnvKey, pipes.SyslogTLSCAFileEnvKey, pipes.SyslogTLSInsecureSkipVerifyEnvKey, pipes.SyslogEncodingEnvKey,
+				pipes.NatsURLEnvKey, pipes.NatsSubjectTemplateEnvKey, pipes.NatsEnableJetStreamEnvKey, pipes.NatsCredentialsFileEnvKey, pipes.NatsEncodingEnvKey,
+				pipes.CloudEventsURLEnvKey, pipes.CloudEventsModeEnvKey, pipes.CloudEventsRetriesEnvKey, pipes.CloudEventsTimeoutEnvKey, pipes.CloudEventsTLSCAFileEnvKey, pipes.CloudEventsTLSInsecureSkipVerifyEnvKey,
+				pipes.MongodbPasswordEnvKey,
+				pipes.NatsEncodingEnvKey, strings.Join(encoding.Names(), ", ")),
 			EnvVar: "USE_PIPE",
 			Value:  &cli.StringSlice{},
 		},
@@ -113,69 +232,363 @@ func main() {
 			Usage:  "enable the pipes parallel",
 			EnvVar: "PIPES_PARALLEL",
 		},
+		cli.StringFlag{
+			Name:   "grpc-listen-address",
+			Usage:  "listen address of the gRPC server for subscribing and listing events, blank means disabled",
+			EnvVar: "GRPC_LISTEN_ADDRESS",
+		},
+		cli.StringFlag{
+			Name:   "http-listen-address",
+			Usage:  "listen address of the HTTP server for querying and streaming events and exposing metrics, blank means disabled",
+			EnvVar: "HTTP_LISTEN_ADDRESS",
+		},
+		cli.IntFlag{
+			Name:   "subscription-buffer",
+			Usage:  "buffer size of each gRPC or HTTP stream subscriber, the events overflowing it are dropped",
+			EnvVar: "SUBSCRIPTION_BUFFER",
+			Value:  streams.DefaultSubscriptionBufferSize,
+		},
 	}
 
 	app.Run(os.Args)
 }
 
+// mergePipes merges the pipes enabled by flags, which are named by their types,
+// into the pipes of the configuration file, and the pipes and the scopes declared
+// by the resources join them.
+func mergePipes(usePipes []string, c *config.Config, resources *crds.Resources) (*eventExporterPipes, error) {
+	ep := &eventExporterPipes{}
+
+	names := make(map[string]struct{}, len(usePipes))
+	for _, usePipe := range usePipes {
+		if _, ok := names[usePipe]; ok || len(usePipe) == 0 {
+			continue
+		}
+		names[usePipe] = struct{}{}
+		ep.Pipes = append(ep.Pipes, config.PipeConfig{Name: usePipe, Type: usePipe, Envs: true})
+	}
+	sort.Slice(ep.Pipes, func(i, j int) bool {
+		return ep.Pipes[i].Name < ep.Pipes[j].Name
+	})
+
+	var (
+		routesConfig *routes.Config
+		tenants      []*routes.Tenant
+	)
+	if c != nil {
+		for _, pipe := range c.Pipes {
+			if _, ok := names[pipe.Name]; ok {
+				return nil, fmt.Errorf("pipe %s is both enabled by flag and configured", pipe.Name)
+			}
+			ep.Pipes = append(ep.Pipes, pipe)
+		}
+		ep.DropRules = c.DropRules
+
+		chain, err := transforms.NewChain(c.Transforms)
+		if err != nil {
+			return nil, err
+		}
+		ep.Transforms = chain
+
+		routesConfig = c.Routes
+		tenants = c.Tenants
+		ep.Limits = c.Limits
+	}
+
+	var scopes []*routes.Scope
+	if resources != nil {
+		// the names of the declared pipes contain the namespaces, so they can't clash with the others
+		ep.Pipes = append(ep.Pipes, resources.Pipes...)
+		scopes = resources.Scopes
+	}
+
+	pipeNames := make([]string, 0, len(ep.Pipes))
+	for _, pipe := range ep.Pipes {
+		pipeNames = append(pipeNames, pipe.Name)
+	}
+	// the stream pipe serves the subscribers, which select the events by themselves
+	table, err := routes.NewTable(routesConfig, tenants, scopes, pipeNames, streamPipeName)
+	if err != nil {
+		return nil, err
+	}
+	ep.Routes = table
+
+	// the events are classified by the default rules without the configuration file
+	var classification *classify.Config
+	if c != nil {
+		classification = c.Classification
+	}
+	classifier, err := classify.NewClassifier(classification)
+	if err != nil {
+		return nil, err
+	}
+	ep.Classifier = classifier
+
+	return ep, nil
+}
+
+// loadConfigClusters loads the clusters of the configuration file, the broken ones are skipped.
+func loadConfigClusters(c *config.Config) []*clusters.Cluster {
+	if c == nil {
+		return nil
+	}
+
+	var ret []*clusters.Cluster
+	for _, clusterConfig := range c.Clusters {
+		options := &clusters.KubeconfigOptions{
+			Aliases: map[string]string{clusterConfig.Context: clusterConfig.Name},
+		}
+		if len(clusterConfig.Context) != 0 {
+			options.Contexts = []string{clusterConfig.Context}
+		}
+
+		cs, err := clusters.LoadKubeconfig(clusterConfig.Kubeconfig, options)
+		if err != nil {
+			logrus.WithError(err).Errorf("failed to load cluster %s from %s", clusterConfig.Name, clusterConfig.Kubeconfig)
+			continue
+		}
+		for _, cluster := range cs {
+			cluster.Name = clusterConfig.Name
+			ret = append(ret, cluster)
+		}
+	}
+
+	return ret
+}
+
 func appAction(c *cli.Context) {
 	var (
-		resyncPeriod  = c.Duration("resync-period")
-		storageTTL    = c.Duration("storage-ttl")
-		kubeconfigs   = c.StringSlice("kubeconfig")
-		usePipes      = c.StringSlice("use-pipe")
-		pipesParallel = c.Bool("pipes-parallel")
-
-		stopChan = newSystemStopChannel()
-		g        = &wait.Group{}
-		kconfigs []*rest.Config
+		resyncPeriod        = c.Duration("resync-period")
+		storageTTL          = c.Duration("storage-ttl")
+		kubeconfigs         = c.StringSlice("kubeconfig")
+		kubeContexts        = c.StringSlice("kube-context")
+		kubeconfigDir       = c.String("kubeconfig-dir")
+		kubeconfigDirPeriod = c.Duration("kubeconfig-dir-period")
+		clusterAliases      = c.StringSlice("cluster-alias")
+		configPath          = c.String("config")
+		configReloadPeriod  = c.Duration("config-reload-period")
+		inClusterName       = c.String("in-cluster-name")
+		skipInCluster       = c.Bool("skip-in-cluster")
+		secretSelector      = c.String("cluster-secret-selector")
+		secretNamespace     = c.String("cluster-secret-namespace")
+		crdWatch            = c.Bool("crd-watch")
+		crdPipeTypes        = c.String("crd-pipe-types")
+		usePipes            = c.StringSlice("use-pipe")
+		pipesParallel       = c.Bool("pipes-parallel")
+		grpcAddress         = c.String("grpc-listen-address")
+		httpAddress         = c.String("http-listen-address")
+		subBuffer           = c.Int("subscription-buffer")
+		restartBackoff      = c.Duration("restart-backoff")
+		restartBackoffMax   = c.Duration("restart-backoff-max")
+		shutdownTimeout     = c.Duration("shutdown-timeout")
+
+		stopChan      = newSystemStopChannel()
+		hub           *streams.Hub
+		configWatcher *config.Watcher
+		fileConfig    *config.Config
+		crdResources  *crds.Resources
+		reloadMu      sync.Mutex
 	)
 
 	initLog(c)
 
-	if len(kubeconfigs) == 0 {
-		kconfig, err := rest.InClusterConfig()
+	if len(configPath) != 0 {
+		configWatcher = config.NewWatcher(&config.WatcherConfig{
+			Path:   configPath,
+			Period: configReloadPeriod,
+		})
+
+		var err error
+		fileConfig, err = configWatcher.Load()
 		if err != nil {
-			logrus.WithError(err).Fatalln("failed to create Kubernetes config from in-cluster")
+			logrus.WithError(err).Fatalln("failed to load configuration from", configPath)
+		}
+	}
+
+	exporterPipes, err := mergePipes(usePipes, fileConfig, nil)
+	if err != nil {
+		logrus.WithError(err).Fatalln("failed to merge pipes")
+	}
+
+	if len(exporterPipes.Pipes) == 0 && len(grpcAddress) == 0 && len(httpAddress) == 0 && !crdWatch {
+		logrus.Fatalln("failed to create sink, there aren't any pipes enabled")
+	}
+
+	if len(grpcAddress) != 0 || len(httpAddress) != 0 {
+		hub = streams.NewHub()
+	}
+
+	exporterConfig := &eventExporterConfig{
+		ResyncPeriod:    resyncPeriod,
+		StorageTTL:      storageTTL,
+		PipesParallel:   pipesParallel,
+		Hub:             hub,
+		ShutdownTimeout: shutdownTimeout,
+	}
+
+	exporters := newEventExporters(exporterConfig, exporterPipes)
+	registry := clusters.NewRegistry(exporters.Run, &clusters.Backoff{
+		Initial: restartBackoff,
+		Max:     restartBackoffMax,
+	})
+
+	if len(grpcAddress) != 0 {
+		server := rpc.NewServer(&rpc.ServerConfig{
+			ListenAddress:          grpcAddress,
+			Hub:                    hub,
+			SubscriptionBufferSize: subBuffer,
+		})
+		if err := server.Run(stopChan); err != nil {
+			logrus.WithError(err).Fatalln("failed to run gRPC server")
+		}
+	}
+
+	if len(httpAddress) != 0 {
+		server := rest.NewServer(&rest.ServerConfig{
+			ListenAddress:          httpAddress,
+			Hub:                    hub,
+			SubscriptionBufferSize: subBuffer,
+			ClusterStatuses:        registry.Statuses,
+		})
+		if err := server.Run(stopChan); err != nil {
+			logrus.WithError(err).Fatalln("failed to run HTTP server")
+		}
+	}
+
+	// the contexts may be spread across the kubeconfigs
+	kubeconfigOptions := &clusters.KubeconfigOptions{
+		Contexts:      kubeContexts,
+		Aliases:       make(map[string]string, len(clusterAliases)),
+		IgnoreMissing: len(kubeconfigs) > 1 || len(kubeconfigDir) != 0,
+	}
+	for _, clusterAlias := range clusterAliases {
+		kv := strings.SplitN(clusterAlias, "=", 2)
+		if len(kv) != 2 || len(kv[0]) == 0 || len(kv[1]) == 0 {
+			logrus.Fatalf("invalid cluster alias %q, expected <context>=<name>", clusterAlias)
+		}
+		kubeconfigOptions.Aliases[kv[0]] = kv[1]
+	}
+
+	configClusters := loadConfigClusters(fileConfig)
+
+	// the in-cluster is exported along with the clusters registered at runtime,
+	// unless it's skipped explicitly
+	var staticClusters []*clusters.Cluster
+	if len(kubeconfigs) == 0 && len(configClusters) == 0 && !skipInCluster {
+		cluster, err := clusters.LoadInCluster(inClusterName)
+		if err != nil {
+			logrus.WithError(err).Fatalln("failed to create Kubernetes config from in-cluster, use --skip-in-cluster if it's not wanted")
 		}
 
-		kconfigs = append(kconfigs, kconfig)
+		staticClusters = append(staticClusters, cluster)
 	} else {
 		for _, kconfigPath := range kubeconfigs {
 			if len(kconfigPath) != 0 {
-				if _, err := os.Stat(kconfigPath); err != nil {
-					logrus.WithError(err).Fatalln("can't open", kconfigPath)
-				} else {
-					kconfig, err := clientcmd.BuildConfigFromFlags("", kconfigPath)
-					if err != nil {
-						logrus.WithError(err).Fatalln("failed to create Kubernetes config from", kconfigPath)
-					}
-
-					kconfigs = append(kconfigs, kconfig)
+				cs, err := clusters.LoadKubeconfig(kconfigPath, kubeconfigOptions)
+				if err != nil {
+					logrus.WithError(err).Fatalln("failed to create Kubernetes config from", kconfigPath)
 				}
+
+				staticClusters = append(staticClusters, cs...)
+			}
+		}
+	}
+	registry.Sync("static", staticClusters)
+	registry.Sync("config", configClusters)
+
+	if configWatcher != nil {
+		configWatcher.OnReload(func(c *config.Config) error {
+			reloadMu.Lock()
+			defer reloadMu.Unlock()
+
+			ep, err := mergePipes(usePipes, c, crdResources)
+			if err != nil {
+				return err
 			}
+			if err := exporters.Reload(ep); err != nil {
+				return err
+			}
+			fileConfig = c
+
+			registry.Sync("config", loadConfigClusters(c))
+			return nil
+		})
+		go configWatcher.Run(stopChan)
+	}
+
+	if len(kubeconfigDir) != 0 {
+		go clusters.NewDirectoryWatcher(&clusters.DirectoryWatcherConfig{
+			Directory:         kubeconfigDir,
+			Period:            kubeconfigDirPeriod,
+			KubeconfigOptions: kubeconfigOptions,
+			Registry:          registry,
+		}).Run(stopChan)
+	}
+
+	if len(secretSelector) != 0 {
+		cluster, err := clusters.LoadInCluster(inClusterName)
+		if err != nil {
+			logrus.WithError(err).Fatalln("failed to create Kubernetes config from in-cluster")
+		}
+		kclient, err := kubernetes.NewForConfig(cluster.Config)
+		if err != nil {
+			logrus.WithError(err).Fatalln("failed to create Kubernetes client from in-cluster")
 		}
+
+		if len(secretNamespace) == 0 {
+			secretNamespace = clusters.CurrentNamespace()
+		}
+
+		go clusters.NewSecretWatcher(&clusters.SecretWatcherConfig{
+			Client:        kclient,
+			Namespace:     secretNamespace,
+			LabelSelector: secretSelector,
+			ResyncPeriod:  resyncPeriod,
+			Registry:      registry,
+		}).Run(stopChan)
 	}
 
-	for _, kconfig := range kconfigs {
-		khost := kconfig.Host
-		kclient, err := kubernetes.NewForConfig(kconfig)
+	if crdWatch {
+		cluster, err := clusters.LoadInCluster(inClusterName)
+		if err != nil {
+			logrus.WithError(err).Fatalln("failed to create Kubernetes config from in-cluster")
+		}
+		kclient, err := kubernetes.NewForConfig(cluster.Config)
+		if err != nil {
+			logrus.WithError(err).Fatalln("failed to create Kubernetes client from in-cluster")
+		}
+		dclient, err := dynamic.NewForConfig(cluster.Config)
 		if err != nil {
-			logrus.WithError(err).Fatalf("failed to create Kubernetes client for %s", khost)
+			logrus.WithError(err).Fatalln("failed to create Kubernetes dynamic client from in-cluster")
 		}
 
-		g.StartWithChannel(
-			stopChan,
-			newEventExporter(
-				kclient,
-				khost,
-				resyncPeriod,
-				storageTTL,
-				usePipes,
-				pipesParallel,
-			).Run,
-		)
+		go crds.NewWatcher(&crds.WatcherConfig{
+			Client:       dclient,
+			KubeClient:   kclient,
+			Cluster:      cluster.Name,
+			PipeTypes:    strings.Split(crdPipeTypes, ","),
+			ResyncPeriod: resyncPeriod,
+			OnChange: func(resources *crds.Resources) error {
+				reloadMu.Lock()
+				defer reloadMu.Unlock()
+
+				ep, err := mergePipes(usePipes, fileConfig, resources)
+				if err != nil {
+					return err
+				}
+				if err := exporters.Reload(ep); err != nil {
+					return err
+				}
+				crdResources = resources
+				return nil
+			},
+		}).Run(stopChan)
 	}
 
-	g.Wait()
+	<-stopChan
+	if err := registry.Stop(); err != nil {
+		logrus.WithError(err).Errorln("failed to shut down gracefully")
+		os.Exit(1)
+	}
+	logrus.Infoln("shut down gracefully")
 }
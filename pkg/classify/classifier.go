@@ -0,0 +1,182 @@
+package classify
+
+import (
+	"path"
+	"regexp"
+
+	"github.com/juju/errors"
+	apiCoreV1 "k8s.io/api/core/v1"
+)
+
+const (
+	// SeverityLabel and CategoryLabel are the labels of the classified events,
+	// so that every pipe, route and expression can use them.
+	SeverityLabel = "event-exporter.thxcode.io/severity"
+	CategoryLabel = "event-exporter.thxcode.io/category"
+
+	SeverityInfo     = "info"
+	SeverityLow      = "low"
+	SeverityMedium   = "medium"
+	SeverityHigh     = "high"
+	SeverityCritical = "critical"
+
+	CategoryOther = "other"
+)
+
+var severities = map[string]struct{}{
+	SeverityInfo:     {},
+	SeverityLow:      {},
+	SeverityMedium:   {},
+	SeverityHigh:     {},
+	SeverityCritical: {},
+}
+
+// Config represents the classification of the events, e.g.
+//
+//	rules:
+//	- kinds: [Pod]
+//	  reasons: [BackOff]
+//	  message: 'pulling image'
+//	  severity: medium
+//	  category: image
+//
+// The rules are evaluated in order before the default rules of the well-known reasons,
+// the first matched rule classifies the event. An unmatched event is classified by its
+// type, medium for Warning and info for the others, into the other category.
+type Config struct {
+	Rules           []*Rule `json:"rules,omitempty"`
+	DisableDefaults bool    `json:"disableDefaults,omitempty"`
+	// Disabled leaves the events unclassified.
+	Disabled bool `json:"disabled,omitempty"`
+}
+
+// Rule matches the kind of the involved object and the reason by the glob patterns,
+// and the message by the regular expression, a blank field matches anything.
+type Rule struct {
+	Kinds    []string `json:"kinds,omitempty"`
+	Reasons  []string `json:"reasons,omitempty"`
+	Message  string   `json:"message,omitempty"`
+	Severity string   `json:"severity"`
+	Category string   `json:"category"`
+}
+
+type compiledRule struct {
+	*Rule
+	message *regexp.Regexp
+}
+
+func (r *compiledRule) match(event *apiCoreV1.Event) bool {
+	return matchAny(r.Kinds, event.InvolvedObject.Kind) &&
+		matchAny(r.Reasons, event.Reason) &&
+		(r.message == nil || r.message.MatchString(event.Message))
+}
+
+// Classifier maps the events to the severities and the categories,
+// it is safe for concurrent use.
+type Classifier struct {
+	rules []*compiledRule
+}
+
+// Classify returns the severity and the category of the event.
+func (c *Classifier) Classify(event *apiCoreV1.Event) (string, string) {
+	for _, rule := range c.rules {
+		if rule.match(event) {
+			return rule.Severity, rule.Category
+		}
+	}
+
+	if event.Type == apiCoreV1.EventTypeWarning {
+		return SeverityMedium, CategoryOther
+	}
+	return SeverityInfo, CategoryOther
+}
+
+// Apply returns a copy of the event labeled by its classification,
+// a nil classifier returns the event as it is.
+func (c *Classifier) Apply(event *apiCoreV1.Event) *apiCoreV1.Event {
+	if c == nil || event == nil {
+		return event
+	}
+
+	severity, category := c.Classify(event)
+
+	classified := event.DeepCopy()
+	if classified.Labels == nil {
+		classified.Labels = make(map[string]string, 2)
+	}
+	classified.Labels[SeverityLabel] = severity
+	classified.Labels[CategoryLabel] = category
+
+	return classified
+}
+
+// NewClassifier compiles the rules, a nil config uses the default rules only,
+// and a disabled config returns a nil classifier.
+func NewClassifier(config *Config) (*Classifier, error) {
+	if config == nil {
+		config = &Config{}
+	}
+	if config.Disabled {
+		return nil, nil
+	}
+
+	rules := config.Rules
+	if !config.DisableDefaults {
+		rules = append(append([]*Rule{}, rules...), defaultRules...)
+	}
+
+	c := &Classifier{
+		rules: make([]*compiledRule, 0, len(rules)),
+	}
+	for i, rule := range rules {
+		compiled, err := compile(rule)
+		if err != nil {
+			return nil, errors.Annotatef(err, "invalid classification rule #%d", i)
+		}
+		c.rules = append(c.rules, compiled)
+	}
+
+	return c, nil
+}
+
+func compile(rule *Rule) (*compiledRule, error) {
+	if rule == nil {
+		return nil, errors.New("blank rule")
+	}
+	if _, ok := severities[rule.Severity]; !ok {
+		return nil, errors.Errorf("severity must be info, low, medium, high or critical, but got %q", rule.Severity)
+	}
+	if len(rule.Category) == 0 {
+		return nil, errors.New("category is required")
+	}
+
+	for _, pattern := range append(append([]string{}, rule.Kinds...), rule.Reasons...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, errors.Annotatef(err, "invalid pattern %s", pattern)
+		}
+	}
+
+	compiled := &compiledRule{Rule: rule}
+	if len(rule.Message) != 0 {
+		var err error
+		if compiled.message, err = regexp.Compile(rule.Message); err != nil {
+			return nil, errors.Annotatef(err, "can't compile message %s", rule.Message)
+		}
+	}
+
+	return compiled, nil
+}
+
+func matchAny(patterns []string, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, value); matched {
+			return true
+		}
+	}
+
+	return false
+}
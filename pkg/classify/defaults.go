@@ -0,0 +1,36 @@
+package classify
+
+// defaultRules classify the well-known reasons reported by the Kubernetes components,
+// the more specific rules come first.
+var defaultRules = []*Rule{
+	// scheduling
+	{Reasons: []string{"FailedScheduling"}, Severity: SeverityHigh, Category: "scheduling"},
+	{Reasons: []string{"Preempted", "Preempting"}, Severity: SeverityLow, Category: "scheduling"},
+	{Reasons: []string{"Scheduled"}, Severity: SeverityInfo, Category: "scheduling"},
+
+	// image
+	{Reasons: []string{"BackOff"}, Message: `(?i)pulling image`, Severity: SeverityMedium, Category: "image"},
+	{Reasons: []string{"Failed"}, Message: `(?i)image`, Severity: SeverityHigh, Category: "image"},
+	{Reasons: []string{"ErrImagePull", "ImagePullBackOff", "ErrImageNeverPull", "InspectFailed"}, Severity: SeverityHigh, Category: "image"},
+	{Reasons: []string{"Pulling", "Pulled"}, Severity: SeverityInfo, Category: "image"},
+
+	// storage
+	{Reasons: []string{"FailedMount", "FailedAttachVolume", "FailedMapVolume", "FailedDetachVolume", "VolumeResizeFailed", "ProvisioningFailed", "FileSystemResizeFailed"}, Severity: SeverityHigh, Category: "storage"},
+	{Reasons: []string{"SuccessfulAttachVolume", "SuccessfulDetachVolume", "ProvisioningSucceeded", "VolumeResizeSuccessful", "FileSystemResizeSuccessful"}, Severity: SeverityInfo, Category: "storage"},
+
+	// node health
+	{Kinds: []string{"Node"}, Reasons: []string{"NodeNotReady"}, Severity: SeverityCritical, Category: "node-health"},
+	{Reasons: []string{"NodeHasDiskPressure", "NodeHasInsufficientMemory", "NodeHasInsufficientPID", "EvictionThresholdMet", "SystemOOM", "OOMKilling", "FreeDiskSpaceFailed", "ImageGCFailed"}, Severity: SeverityHigh, Category: "node-health"},
+	{Reasons: []string{"Evicted"}, Severity: SeverityHigh, Category: "node-health"},
+	{Reasons: []string{"Rebooted", "NodeNotSchedulable"}, Severity: SeverityMedium, Category: "node-health"},
+	{Reasons: []string{"NodeReady", "NodeSchedulable", "Starting", "RegisteredNode", "NodeHasSufficientMemory", "NodeHasNoDiskPressure", "NodeHasSufficientPID"}, Severity: SeverityInfo, Category: "node-health"},
+
+	// probe
+	{Reasons: []string{"Unhealthy"}, Severity: SeverityMedium, Category: "probe"},
+	{Reasons: []string{"ProbeWarning"}, Severity: SeverityLow, Category: "probe"},
+
+	// container
+	{Message: `OOMKilled`, Severity: SeverityHigh, Category: "container"},
+	{Reasons: []string{"BackOff", "FailedCreatePodSandBox", "FailedKillPod", "FailedPreStopHook", "FailedPostStartHook"}, Severity: SeverityHigh, Category: "container"},
+	{Reasons: []string{"Created", "Started", "Killing", "SandboxChanged"}, Severity: SeverityInfo, Category: "container"},
+}
@@ -0,0 +1,120 @@
+package clusters
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"sort"
+
+	"github.com/juju/errors"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// AllContexts selects every context of a kubeconfig.
+const AllContexts = "*"
+
+// Cluster represents a Kubernetes cluster which the exporter watches.
+type Cluster struct {
+	// Name is the human-friendly identity of the cluster.
+	Name string
+	// Revision changes whenever the configuration of the cluster changes.
+	Revision string
+	Config   *rest.Config
+}
+
+// KubeconfigOptions selects the clusters from a kubeconfig.
+type KubeconfigOptions struct {
+	// Contexts selects the contexts to use, blank means the current context,
+	// AllContexts means every context.
+	Contexts []string
+	// Aliases renames the clusters, keyed by the context name.
+	Aliases map[string]string
+	// IgnoreMissing skips the selected contexts which the kubeconfig hasn't rather than
+	// failing, e.g. the contexts are spread across several kubeconfigs.
+	IgnoreMissing bool
+}
+
+// LoadKubeconfig creates a cluster for each selected context of the kubeconfig file,
+// the cluster is named by its context name unless an alias is given.
+func LoadKubeconfig(path string, options *KubeconfigOptions) ([]*Cluster, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Annotatef(err, "can't read %s", path)
+	}
+
+	// load from file rather than the read data, which resolves the relative paths
+	kconfig, err := clientcmd.LoadFromFile(path)
+	if err != nil {
+		return nil, errors.Annotatef(err, "can't load %s", path)
+	}
+
+	var contexts []string
+	switch {
+	case len(options.Contexts) == 0:
+		if len(kconfig.CurrentContext) == 0 {
+			return nil, errors.Errorf("%s hasn't a current context", path)
+		}
+		contexts = []string{kconfig.CurrentContext}
+	case len(options.Contexts) == 1 && options.Contexts[0] == AllContexts:
+		for context := range kconfig.Contexts {
+			contexts = append(contexts, context)
+		}
+		sort.Strings(contexts)
+	default:
+		for _, context := range options.Contexts {
+			if _, ok := kconfig.Contexts[context]; !ok {
+				if options.IgnoreMissing {
+					continue
+				}
+				return nil, errors.NotFoundf("%s context of %s", context, path)
+			}
+			contexts = append(contexts, context)
+		}
+	}
+
+	ret := make([]*Cluster, 0, len(contexts))
+	for _, context := range contexts {
+		config, err := clientcmd.NewNonInteractiveClientConfig(*kconfig, context, &clientcmd.ConfigOverrides{}, nil).ClientConfig()
+		if err != nil {
+			return nil, errors.Annotatef(err, "can't create config from %s context of %s", context, path)
+		}
+
+		name := context
+		if alias, ok := options.Aliases[context]; ok {
+			name = alias
+		}
+
+		ret = append(ret, &Cluster{
+			Name:     name,
+			Revision: hashing(data, []byte(context)),
+			Config:   config,
+		})
+	}
+
+	return ret, nil
+}
+
+// LoadInCluster creates the cluster which the exporter is running in.
+func LoadInCluster(name string) (*Cluster, error) {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Cluster{
+		Name:     name,
+		Revision: hashing([]byte(config.Host)),
+		Config:   config,
+	}, nil
+}
+
+func hashing(data ...[]byte) string {
+	hasher := sha256.New()
+	for _, d := range data {
+		hasher.Write(d)
+		hasher.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(hasher.Sum(nil))
+}
@@ -0,0 +1,92 @@
+package clusters
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/utils/logger"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// DirectoryWatcherConfig represents the configuration of the kubeconfig directory watcher.
+type DirectoryWatcherConfig struct {
+	Directory         string
+	Period            time.Duration
+	KubeconfigOptions *KubeconfigOptions
+	Registry          *Registry
+}
+
+// DirectoryWatcher loads every kubeconfig file inside a directory, and synchronizes
+// the clusters to the registry when the files are added, changed or removed.
+// The hidden files are skipped, e.g. the "..data" links of the mounted ConfigMaps or Secrets.
+type DirectoryWatcher struct {
+	logContext logrus.Fields
+
+	directory         string
+	period            time.Duration
+	kubeconfigOptions *KubeconfigOptions
+	registry          *Registry
+
+	// the clusters of the files which loaded successfully last time,
+	// a broken file, e.g. during writing, keeps its previous clusters
+	loaded map[string][]*Cluster
+}
+
+func (w *DirectoryWatcher) Run(stopCh <-chan struct{}) {
+	logrus.WithFields(w.logContext).Debugf("watching %s", w.directory)
+	wait.Until(w.sync, w.period, stopCh)
+	logrus.WithFields(w.logContext).Debugln("stopped")
+}
+
+func (w *DirectoryWatcher) sync() {
+	fileInfos, err := ioutil.ReadDir(w.directory)
+	if err != nil {
+		logrus.WithFields(w.logContext).WithError(err).Warnf("failed to read %s", w.directory)
+		return
+	}
+
+	loaded := make(map[string][]*Cluster, len(fileInfos))
+	for _, fileInfo := range fileInfos {
+		if strings.HasPrefix(fileInfo.Name(), ".") {
+			continue
+		}
+
+		path := filepath.Join(w.directory, fileInfo.Name())
+		// follow the links
+		if fileInfo, err = os.Stat(path); err != nil || !fileInfo.Mode().IsRegular() {
+			continue
+		}
+
+		clusters, err := LoadKubeconfig(path, w.kubeconfigOptions)
+		if err != nil {
+			logrus.WithFields(w.logContext).WithError(err).Warnf("failed to load %s", path)
+			if previous, ok := w.loaded[path]; ok {
+				loaded[path] = previous
+			}
+			continue
+		}
+		loaded[path] = clusters
+	}
+	w.loaded = loaded
+
+	var all []*Cluster
+	for _, clusters := range loaded {
+		all = append(all, clusters...)
+	}
+	w.registry.Sync("directory:"+w.directory, all)
+}
+
+func NewDirectoryWatcher(config *DirectoryWatcherConfig) *DirectoryWatcher {
+	return &DirectoryWatcher{
+		logContext: logger.CreateLogContext("CLUSTERS<dir>", ""),
+
+		directory:         config.Directory,
+		period:            config.Period,
+		kubeconfigOptions: config.KubeconfigOptions,
+		registry:          config.Registry,
+	}
+}
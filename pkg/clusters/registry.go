@@ -0,0 +1,157 @@
+package clusters
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/juju/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/utils/logger"
+)
+
+// RunFunc runs the exporting of a cluster until the stop channel is closed, it calls
+// started once the exporting has started, the returned error makes the cluster
+// restart after a backoff.
+type RunFunc func(cluster *Cluster, started func(), stopCh <-chan struct{}) error
+
+// Registry keeps a supervised exporter for each cluster reported by the sources,
+// and starts, restarts or stops them as the sources change. Each cluster runs with
+// its own context, so that a failing cluster never affects the others.
+type Registry struct {
+	logContext logrus.Fields
+
+	run     RunFunc
+	backoff *Backoff
+
+	running map[string]*supervisor
+	stopped bool
+	sync.Mutex
+}
+
+// Sync replaces the clusters reported by the source, a cluster is restarted when its
+// revision changes. A cluster name can only be owned by one source at the same time.
+// The replaced clusters are stopped concurrently without holding the registry, and
+// a restarted cluster waits for its previous run to stop.
+func (r *Registry) Sync(source string, clusters []*Cluster) {
+	r.Lock()
+	if r.stopped {
+		r.Unlock()
+		return
+	}
+
+	reported := make(map[string]*Cluster, len(clusters))
+	for _, cluster := range clusters {
+		if _, ok := reported[cluster.Name]; ok {
+			logrus.WithFields(r.logContext).Warnf("ignoring duplicated cluster %s from %s", cluster.Name, source)
+			continue
+		}
+		reported[cluster.Name] = cluster
+	}
+
+	stopping := make(map[string]*supervisor)
+	for name, s := range r.running {
+		if s.source != source {
+			continue
+		}
+
+		if cluster, ok := reported[name]; ok && cluster.Revision == s.cluster.Revision {
+			continue
+		}
+
+		logrus.WithFields(r.logContext).Infof("stopping cluster %s", name)
+		s.cancelFunc()
+		stopping[name] = s
+		delete(r.running, name)
+	}
+
+	for name, cluster := range reported {
+		if s, ok := r.running[name]; ok {
+			if s.source != source {
+				logrus.WithFields(r.logContext).Warnf("ignoring cluster %s from %s, which is owned by %s", name, source, s.source)
+			}
+			continue
+		}
+
+		logrus.WithFields(r.logContext).Infof("starting cluster %s (%s)", name, cluster.Config.Host)
+		s := newSupervisor(context.Background(), source, cluster, r.run, r.backoff)
+		r.running[name] = s
+		var previousDoneCh <-chan struct{}
+		if previous, ok := stopping[name]; ok {
+			previousDoneCh = previous.doneCh
+		}
+		go s.Run(previousDoneCh)
+	}
+	r.Unlock()
+
+	r.stopAll(stopping)
+}
+
+// Statuses returns the status of each cluster, ordered by name.
+func (r *Registry) Statuses() []Status {
+	r.Lock()
+	defer r.Unlock()
+
+	ret := make([]Status, 0, len(r.running))
+	for _, s := range r.running {
+		ret = append(ret, s.Status())
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+
+	return ret
+}
+
+// Stop stops all clusters and waits for them, the later synchronizations are ignored.
+// It returns an error if any cluster failed to stop cleanly.
+func (r *Registry) Stop() error {
+	r.Lock()
+	r.stopped = true
+	stopping := r.running
+	r.running = make(map[string]*supervisor)
+	r.Unlock()
+
+	if failed := r.stopAll(stopping); len(failed) != 0 {
+		return errors.Errorf("clusters %s failed to stop cleanly", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// stopAll stops the supervisors concurrently and waits for them,
+// it returns the sorted names of the clusters which failed to stop cleanly.
+func (r *Registry) stopAll(supervisors map[string]*supervisor) []string {
+	var (
+		failed     []string
+		failedLock sync.Mutex
+		wg         sync.WaitGroup
+	)
+	for name, s := range supervisors {
+		wg.Add(1)
+		go func(name string, s *supervisor) {
+			defer wg.Done()
+			if err := s.stop(); err != nil {
+				logrus.WithFields(r.logContext).WithError(err).Errorf("cluster %s failed to stop cleanly", name)
+
+				failedLock.Lock()
+				failed = append(failed, name)
+				failedLock.Unlock()
+			}
+		}(name, s)
+	}
+	wg.Wait()
+
+	sort.Strings(failed)
+	return failed
+}
+
+func NewRegistry(run RunFunc, backoff *Backoff) *Registry {
+	return &Registry{
+		logContext: logger.CreateLogContext("CLUSTERS", ""),
+
+		run:     run,
+		backoff: backoff,
+		running: make(map[string]*supervisor),
+	}
+}
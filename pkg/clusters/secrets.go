@@ -0,0 +1,204 @@
+package clusters
+
+import (
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/utils/logger"
+	apiCoreV1 "k8s.io/api/core/v1"
+	apisMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	// SecretClusterNameAnnotation names the cluster, the Secret name is used by default.
+	SecretClusterNameAnnotation = "kubernetes-event-exporter.thxcode.io/cluster-name"
+
+	// SecretKubeconfigKey holds a kubeconfig, which takes precedence over the other keys.
+	SecretKubeconfigKey = "kubeconfig"
+	// SecretContextKey selects the context of the kubeconfig, blank means the current context.
+	SecretContextKey = "context"
+	// SecretServerKey, SecretTokenKey and SecretCAKey hold the API server address,
+	// the bearer token and the CA bundle when there isn't a kubeconfig.
+	SecretServerKey = "server"
+	SecretTokenKey  = "token"
+	SecretCAKey     = "ca.crt"
+
+	serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+)
+
+// SecretWatcherConfig represents the configuration of the cluster Secret watcher.
+type SecretWatcherConfig struct {
+	Client        kubernetes.Interface
+	Namespace     string
+	LabelSelector string
+	ResyncPeriod  time.Duration
+	Registry      *Registry
+}
+
+// SecretWatcher registers a cluster for each Secret matching the label selector inside
+// the namespace, and synchronizes the clusters to the registry when the Secrets are
+// created, changed or deleted.
+type SecretWatcher struct {
+	logContext logrus.Fields
+
+	namespace string
+	registry  *Registry
+
+	store      cache.Store
+	controller cache.Controller
+}
+
+func (w *SecretWatcher) Run(stopCh <-chan struct{}) {
+	logrus.WithFields(w.logContext).Debugf("watching Secrets of %s namespace", w.namespace)
+	go w.controller.Run(stopCh)
+
+	if cache.WaitForCacheSync(stopCh, w.controller.HasSynced) {
+		w.sync()
+	}
+
+	<-stopCh
+	logrus.WithFields(w.logContext).Debugln("stopped")
+}
+
+func (w *SecretWatcher) sync() {
+	// wait for the initial list, otherwise the clusters would be stopped and started again
+	if !w.controller.HasSynced() {
+		return
+	}
+
+	var clusters []*Cluster
+	for _, obj := range w.store.List() {
+		secret, ok := obj.(*apiCoreV1.Secret)
+		if !ok {
+			continue
+		}
+
+		cluster, err := secretToCluster(secret)
+		if err != nil {
+			logrus.WithFields(w.logContext).WithError(err).Warnf("ignoring Secret %s", secret.Name)
+			continue
+		}
+		clusters = append(clusters, cluster)
+	}
+
+	w.registry.Sync("secrets:"+w.namespace, clusters)
+}
+
+func secretToCluster(secret *apiCoreV1.Secret) (*Cluster, error) {
+	name := secret.Annotations[SecretClusterNameAnnotation]
+	if len(name) == 0 {
+		name = secret.Name
+	}
+
+	var config *rest.Config
+	if kubeconfig := secret.Data[SecretKubeconfigKey]; len(kubeconfig) != 0 {
+		kconfig, err := clientcmd.Load(kubeconfig)
+		if err != nil {
+			return nil, errors.Annotatef(err, "can't load %s", SecretKubeconfigKey)
+		}
+
+		context := string(secret.Data[SecretContextKey])
+		if len(context) == 0 {
+			context = kconfig.CurrentContext
+		}
+
+		config, err = clientcmd.NewNonInteractiveClientConfig(*kconfig, context, &clientcmd.ConfigOverrides{}, nil).ClientConfig()
+		if err != nil {
+			return nil, errors.Annotatef(err, "can't create config from %s context", context)
+		}
+	} else {
+		server := string(secret.Data[SecretServerKey])
+		if len(server) == 0 {
+			return nil, errors.Errorf("neither %s nor %s is found", SecretKubeconfigKey, SecretServerKey)
+		}
+
+		config = &rest.Config{
+			Host:        server,
+			BearerToken: string(secret.Data[SecretTokenKey]),
+			TLSClientConfig: rest.TLSClientConfig{
+				CAData: secret.Data[SecretCAKey],
+			},
+		}
+	}
+
+	keys := make([]string, 0, len(secret.Data))
+	for key := range secret.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	revisionData := [][]byte{[]byte(name)}
+	for _, key := range keys {
+		revisionData = append(revisionData, []byte(key), secret.Data[key])
+	}
+
+	return &Cluster{
+		Name:     name,
+		Revision: hashing(revisionData...),
+		Config:   config,
+	}, nil
+}
+
+// CurrentNamespace returns the namespace which the exporter is running in.
+func CurrentNamespace() string {
+	if namespace := os.Getenv("POD_NAMESPACE"); len(namespace) != 0 {
+		return namespace
+	}
+
+	if data, err := ioutil.ReadFile(serviceAccountNamespaceFile); err == nil {
+		if namespace := strings.TrimSpace(string(data)); len(namespace) != 0 {
+			return namespace
+		}
+	}
+
+	return apiCoreV1.NamespaceDefault
+}
+
+func NewSecretWatcher(config *SecretWatcherConfig) *SecretWatcher {
+	w := &SecretWatcher{
+		logContext: logger.CreateLogContext("CLUSTERS<secret>", ""),
+
+		namespace: config.Namespace,
+		registry:  config.Registry,
+	}
+
+	secrets := config.Client.CoreV1().Secrets(config.Namespace)
+	w.store, w.controller = cache.NewInformer(
+		&cache.ListWatch{
+			ListFunc: func(options apisMetaV1.ListOptions) (runtime.Object, error) {
+				options.LabelSelector = config.LabelSelector
+				return secrets.List(options)
+			},
+			WatchFunc: func(options apisMetaV1.ListOptions) (watch.Interface, error) {
+				options.LabelSelector = config.LabelSelector
+				return secrets.Watch(options)
+			},
+		},
+		&apiCoreV1.Secret{},
+		config.ResyncPeriod,
+		cache.ResourceEventHandlerFuncs{
+			AddFunc: func(interface{}) {
+				w.sync()
+			},
+			UpdateFunc: func(interface{}, interface{}) {
+				w.sync()
+			},
+			DeleteFunc: func(interface{}) {
+				w.sync()
+			},
+		},
+	)
+
+	return w
+}
@@ -0,0 +1,186 @@
+package clusters
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/utils/logger"
+)
+
+type State string
+
+const (
+	StateStarting State = "starting"
+	StateRunning  State = "running"
+	StateFailed   State = "failed"
+	StateStopped  State = "stopped"
+)
+
+var errNotStopped = errors.New("stopped unexpectedly")
+
+// Status represents the running status of a cluster.
+type Status struct {
+	Name      string    `json:"name"`
+	Host      string    `json:"host"`
+	Source    string    `json:"source"`
+	State     State     `json:"state"`
+	Restarts  int       `json:"restarts"`
+	LastError string    `json:"lastError,omitempty"`
+	Since     time.Time `json:"since"`
+}
+
+// Backoff represents the exponential waiting before restarting a failed cluster.
+type Backoff struct {
+	Initial time.Duration
+	Max     time.Duration
+}
+
+func (b *Backoff) Next(current time.Duration) time.Duration {
+	if current <= 0 {
+		return b.Initial
+	}
+
+	if next := current * 2; next < b.Max {
+		return next
+	}
+
+	return b.Max
+}
+
+// supervisor runs a cluster and restarts it with backoff when it fails,
+// until its context is canceled.
+type supervisor struct {
+	logContext logrus.Fields
+
+	source  string
+	cluster *Cluster
+	run     RunFunc
+	backoff *Backoff
+
+	ctx        context.Context
+	cancelFunc context.CancelFunc
+	doneCh     chan struct{}
+
+	status     Status
+	statusLock sync.RWMutex
+	// stopErr is the error returned by the last run after canceling
+	stopErr error
+}
+
+// Run runs the cluster after the previous run of the same cluster is done, if any.
+func (s *supervisor) Run(previousDoneCh <-chan struct{}) {
+	defer close(s.doneCh)
+
+	if previousDoneCh != nil {
+		select {
+		case <-s.ctx.Done():
+			s.setStatus(StateStopped, nil)
+			return
+		case <-previousDoneCh:
+		}
+	}
+
+	var wait time.Duration
+	for {
+		startedAt := time.Now()
+		err := s.runOnce()
+		if s.ctx.Err() != nil {
+			s.stopErr = err
+			s.setStatus(StateStopped, err)
+			return
+		}
+		if err == nil {
+			// the cluster can only stop by canceling, treat it as a failure
+			err = errNotStopped
+		}
+
+		// a cluster which has been running for a while starts over the backoff
+		if time.Since(startedAt) > s.backoff.Max {
+			wait = 0
+		}
+		wait = s.backoff.Next(wait)
+		s.setStatus(StateFailed, err)
+		logrus.WithFields(s.logContext).WithError(err).Errorf("failed, restarting in %s", wait)
+
+		select {
+		case <-s.ctx.Done():
+			s.setStatus(StateStopped, nil)
+			return
+		case <-time.After(wait):
+		}
+
+		s.statusLock.Lock()
+		s.status.Restarts++
+		s.statusLock.Unlock()
+		s.setStatus(StateStarting, nil)
+	}
+}
+
+func (s *supervisor) runOnce() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(error); ok {
+				err = e
+			} else {
+				err = errors.Errorf("panic: %v", r)
+			}
+		}
+	}()
+
+	return s.run(s.cluster, func() {
+		s.setStatus(StateRunning, nil)
+	}, s.ctx.Done())
+}
+
+func (s *supervisor) setStatus(state State, err error) {
+	s.statusLock.Lock()
+	defer s.statusLock.Unlock()
+
+	s.status.State = state
+	s.status.Since = time.Now()
+	if err != nil {
+		s.status.LastError = err.Error()
+	}
+}
+
+func (s *supervisor) Status() Status {
+	s.statusLock.RLock()
+	defer s.statusLock.RUnlock()
+
+	return s.status
+}
+
+func (s *supervisor) stop() error {
+	s.cancelFunc()
+	<-s.doneCh
+
+	return s.stopErr
+}
+
+func newSupervisor(parent context.Context, source string, cluster *Cluster, run RunFunc, backoff *Backoff) *supervisor {
+	ctx, cancelFunc := context.WithCancel(parent)
+
+	return &supervisor{
+		logContext: logger.CreateLogContext("SUPERVISOR", cluster.Name),
+
+		source:  source,
+		cluster: cluster,
+		run:     run,
+		backoff: backoff,
+
+		ctx:        ctx,
+		cancelFunc: cancelFunc,
+		doneCh:     make(chan struct{}),
+
+		status: Status{
+			Name:   cluster.Name,
+			Host:   cluster.Config.Host,
+			Source: source,
+			State:  StateStarting,
+			Since:  time.Now(),
+		},
+	}
+}
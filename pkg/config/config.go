@@ -0,0 +1,161 @@
+package config
+
+import (
+	"io/ioutil"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/juju/errors"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/classify"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/limits"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/routes"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/streams"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/transforms"
+)
+
+// Config represents the reloadable configuration file of the exporter, e.g.
+//
+//	clusters:
+//	- name: prod
+//	  kubeconfig: /etc/kubeconfigs/prod.yaml
+//	  context: prod-admin
+//	pipes:
+//	- name: audit
+//	  type: mongodb
+//	  options:
+//	    PIPE_MONGODB_CONNECT_URI: mongodb://mongo:27017
+//	dropRules:
+//	- namespaces: [kube-system]
+//	transforms:
+//	- redact:
+//	    pattern: '://[^/@]+@'
+//	    replacement: '://***@'
+//	- label:
+//	    labels: {cluster: '{cluster}', environment: prod}
+//	- truncate:
+//	    maxLength: 1024
+//	classification:
+//	  rules:
+//	  - reasons: [BackOff]
+//	    severity: high
+//	    category: container
+//	routes:
+//	  rules:
+//	  - match: {types: [Warning]}
+//	    pipes: [audit]
+//	  default: []
+//	tenants:
+//	- name: team-a
+//	  namespaceSelector: tenant=team-a
+//	  pipes: [team-a-audit]
+//	limits:
+//	  qps: 0.2
+//	  burst: 10
+type Config struct {
+	Clusters   []ClusterConfig    `json:"clusters,omitempty"`
+	Pipes      []PipeConfig       `json:"pipes,omitempty"`
+	DropRules  []*streams.Filter  `json:"dropRules,omitempty"`
+	Transforms []*transforms.Rule `json:"transforms,omitempty"`
+	// Classification is applied after the transforms, so the routes can match the classified labels.
+	Classification *classify.Config `json:"classification,omitempty"`
+	Routes         *routes.Config   `json:"routes,omitempty"`
+	// Tenants isolate their pipes from the routes and the events of the other tenants.
+	Tenants []*routes.Tenant `json:"tenants,omitempty"`
+	Limits  *limits.Config   `json:"limits,omitempty"`
+}
+
+// ClusterConfig selects a cluster from a kubeconfig, blank context means the current context.
+type ClusterConfig struct {
+	Name       string `json:"name"`
+	Kubeconfig string `json:"kubeconfig"`
+	Context    string `json:"context,omitempty"`
+}
+
+// PipeConfig represents a named pipe, the options are keyed by the envs of the pipe type,
+// the missing options don't fall back to the envs of the exporter, e.g. a tenant pipe
+// never writes to the database of the exporter.
+type PipeConfig struct {
+	Name    string            `json:"name"`
+	Type    string            `json:"type"`
+	Options map[string]string `json:"options,omitempty"`
+
+	// Envs tells the missing options fall back to the envs of the exporter,
+	// only the pipes enabled by flag set it.
+	Envs bool `json:"-"`
+	// Scoped tells the pipe is declared by a namespace owner, which is skipped
+	// rather than failing the others if it can't start.
+	Scoped bool `json:"-"`
+}
+
+func (c *Config) Validate() error {
+	clusterNames := make(map[string]struct{}, len(c.Clusters))
+	for _, cluster := range c.Clusters {
+		if len(cluster.Name) == 0 || len(cluster.Kubeconfig) == 0 {
+			return errors.New("cluster requires name and kubeconfig")
+		}
+		if _, ok := clusterNames[cluster.Name]; ok {
+			return errors.Errorf("duplicated cluster %s", cluster.Name)
+		}
+		clusterNames[cluster.Name] = struct{}{}
+	}
+
+	pipeNames := make(map[string]struct{}, len(c.Pipes))
+	for _, pipe := range c.Pipes {
+		if len(pipe.Name) == 0 || len(pipe.Type) == 0 {
+			return errors.New("pipe requires name and type")
+		}
+		// the slashes are kept for the pipes declared by the EventExporterPipe resources
+		if strings.Contains(pipe.Name, "/") {
+			return errors.Errorf("pipe name %s can't contain slashes", pipe.Name)
+		}
+		if _, ok := pipeNames[pipe.Name]; ok {
+			return errors.Errorf("duplicated pipe %s", pipe.Name)
+		}
+		pipeNames[pipe.Name] = struct{}{}
+	}
+
+	if _, err := transforms.NewChain(c.Transforms); err != nil {
+		return err
+	}
+
+	if _, err := classify.NewClassifier(c.Classification); err != nil {
+		return err
+	}
+
+	if err := c.Routes.Validate(); err != nil {
+		return err
+	}
+
+	if err := routes.ValidateTenants(c.Tenants); err != nil {
+		return err
+	}
+
+	if err := c.Limits.Validate(); err != nil {
+		return errors.Annotate(err, "invalid limits")
+	}
+
+	return nil
+}
+
+// Load reads and validates the configuration file.
+func Load(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Annotatef(err, "can't read %s", path)
+	}
+
+	return Parse(data)
+}
+
+func Parse(data []byte) (*Config, error) {
+	c := &Config{}
+	if err := yaml.Unmarshal(data, c); err != nil {
+		return nil, errors.Annotate(err, "can't parse configuration")
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, errors.Annotate(err, "invalid configuration")
+	}
+
+	return c, nil
+}
@@ -0,0 +1,119 @@
+package config
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/utils/logger"
+)
+
+// WatcherConfig represents the configuration of the configuration file watcher.
+type WatcherConfig struct {
+	Path string
+	// Period for checking the file changes, zero means only reloading on SIGHUP.
+	Period time.Duration
+}
+
+// Watcher reloads the configuration file on SIGHUP or when its content changes,
+// an invalid configuration is logged and ignored, the previous one keeps working.
+// A configuration failed to apply is retried on the next check even if it's unchanged.
+type Watcher struct {
+	logContext logrus.Fields
+
+	path     string
+	period   time.Duration
+	onReload func(*Config) error
+
+	lastData []byte
+}
+
+// OnReload sets the handler of the reloaded configuration, it must be called before running.
+func (w *Watcher) OnReload(onReload func(*Config) error) {
+	w.onReload = onReload
+}
+
+// Load reads the configuration file for the first time.
+func (w *Watcher) Load() (*Config, error) {
+	data, err := ioutil.ReadFile(w.path)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	w.lastData = data
+
+	return c, nil
+}
+
+func (w *Watcher) Run(stopCh <-chan struct{}) {
+	hupCh := make(chan os.Signal, 1)
+	signal.Notify(hupCh, syscall.SIGHUP)
+	defer signal.Stop(hupCh)
+
+	var tickCh <-chan time.Time
+	if w.period > 0 {
+		ticker := time.NewTicker(w.period)
+		defer ticker.Stop()
+		tickCh = ticker.C
+	}
+
+	logrus.WithFields(w.logContext).Debugf("watching %s", w.path)
+	for {
+		select {
+		case <-stopCh:
+			logrus.WithFields(w.logContext).Debugln("stopped")
+			return
+		case <-hupCh:
+			logrus.WithFields(w.logContext).Infoln("received SIGHUP, reloading")
+			w.reload(true)
+		case <-tickCh:
+			w.reload(false)
+		}
+	}
+}
+
+func (w *Watcher) reload(force bool) {
+	data, err := ioutil.ReadFile(w.path)
+	if err != nil {
+		logrus.WithFields(w.logContext).WithError(err).Warnf("failed to read %s", w.path)
+		return
+	}
+
+	if !force && bytes.Equal(data, w.lastData) {
+		return
+	}
+
+	c, err := Parse(data)
+	if err != nil {
+		// the invalid content is not checked again until it changes
+		w.lastData = data
+		logrus.WithFields(w.logContext).WithError(err).Errorln("ignoring the changed configuration")
+		return
+	}
+
+	logrus.WithFields(w.logContext).Infof("reloading %s", w.path)
+	if w.onReload != nil {
+		if err := w.onReload(c); err != nil {
+			logrus.WithFields(w.logContext).WithError(err).Errorln("failed to apply the changed configuration, retrying on the next check")
+			return
+		}
+	}
+	w.lastData = data
+}
+
+func NewWatcher(config *WatcherConfig) *Watcher {
+	return &Watcher{
+		logContext: logger.CreateLogContext("CONFIG", ""),
+
+		path:   config.Path,
+		period: config.Period,
+	}
+}
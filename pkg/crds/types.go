@@ -0,0 +1,84 @@
+package crds
+
+import (
+	"github.com/thxcode/kubernetes-event-exporter/pkg/expressions"
+	apiCoreV1 "k8s.io/api/core/v1"
+	apisMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	Group   = "event-exporter.thxcode.io"
+	Version = "v1alpha1"
+)
+
+var (
+	EventExporterPipeResource = schema.GroupVersionResource{Group: Group, Version: Version, Resource: "eventexporterpipes"}
+	EventRouteResource        = schema.GroupVersionResource{Group: Group, Version: Version, Resource: "eventroutes"}
+)
+
+// EventExporterPipe declares a pipe owned by its namespace, e.g.
+//
+//	apiVersion: event-exporter.thxcode.io/v1alpha1
+//	kind: EventExporterPipe
+//	metadata:
+//	  name: alerts
+//	  namespace: team-a
+//	spec:
+//	  type: cloudevents
+//	  options:
+//	    PIPE_CLOUDEVENTS_URL: https://alerts.team-a.example.com/events
+//	  secretRef:
+//	    name: alerts-credentials
+//
+// The options are keyed by the envs of the pipe type, the data of the referred Secret
+// in the same namespace are merged into the options, e.g. PIPE_NATS_PASSWORD. The missing
+// options never fall back to the envs of the exporter.
+type EventExporterPipe struct {
+	apisMetaV1.TypeMeta   `json:",inline"`
+	apisMetaV1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec EventExporterPipeSpec `json:"spec"`
+}
+
+type EventExporterPipeSpec struct {
+	Type      string                          `json:"type"`
+	Options   map[string]string               `json:"options,omitempty"`
+	SecretRef *apiCoreV1.LocalObjectReference `json:"secretRef,omitempty"`
+}
+
+// EventRoute routes the events of its namespace to the EventExporterPipes
+// of the same namespace by name, e.g.
+//
+//	apiVersion: event-exporter.thxcode.io/v1alpha1
+//	kind: EventRoute
+//	metadata:
+//	  name: warnings
+//	  namespace: team-a
+//	spec:
+//	  match:
+//	    types: [Warning]
+//	    expression: 'event.count > 3'
+//	  pipes: [alerts]
+type EventRoute struct {
+	apisMetaV1.TypeMeta   `json:",inline"`
+	apisMetaV1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec EventRouteSpec `json:"spec"`
+}
+
+type EventRouteSpec struct {
+	Match *EventRouteMatch `json:"match,omitempty"`
+	Pipes []string         `json:"pipes"`
+}
+
+// EventRouteMatch is like routes.Match without the clusters and the namespaces,
+// which are always the cluster and the namespace of the EventRoute.
+type EventRouteMatch struct {
+	Kinds   []string          `json:"kinds,omitempty"`
+	Types   []string          `json:"types,omitempty"`
+	Reasons []string          `json:"reasons,omitempty"`
+	Labels  map[string]string `json:"labels,omitempty"`
+
+	Expression *expressions.Expression `json:"expression,omitempty"`
+}
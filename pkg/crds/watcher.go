@@ -0,0 +1,319 @@
+package crds
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/config"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/routes"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/utils/logger"
+	apisMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// fileOptionSuffix marks the options read from the files of the exporter,
+// which are not allowed to the namespace owners.
+const fileOptionSuffix = "_FILE"
+
+// Resources represents the pipes and the routing scopes declared by the resources.
+type Resources struct {
+	Pipes  []config.PipeConfig
+	Scopes []*routes.Scope
+}
+
+// WatcherConfig represents the configuration of the resource watcher.
+type WatcherConfig struct {
+	Client     dynamic.Interface
+	KubeClient kubernetes.Interface
+	// Cluster names the cluster which the resources belong to, the routes only select its events.
+	Cluster string
+	// PipeTypes allows the types of the pipes, e.g. cloudevents.
+	PipeTypes    []string
+	ResyncPeriod time.Duration
+	// OnChange applies the changed resources, a failed change is retried on the next resync.
+	OnChange func(*Resources) error
+}
+
+// Watcher watches the EventExporterPipe and EventRoute resources of all namespaces,
+// and notifies the declared pipes and scopes when the resources are created, changed
+// or deleted. The referred Secrets are read on syncing, so a changed Secret takes
+// effect on the next resync. A broken resource is skipped with a warning.
+type Watcher struct {
+	logContext logrus.Fields
+
+	kclient   kubernetes.Interface
+	cluster   string
+	pipeTypes map[string]struct{}
+	onChange  func(*Resources) error
+
+	pipeStore      cache.Store
+	pipeController cache.Controller
+
+	routeStore      cache.Store
+	routeController cache.Controller
+
+	mu   sync.Mutex
+	last *Resources
+}
+
+func (w *Watcher) Run(stopCh <-chan struct{}) {
+	logrus.WithFields(w.logContext).Debugln("watching EventExporterPipes and EventRoutes")
+	go w.pipeController.Run(stopCh)
+	go w.routeController.Run(stopCh)
+
+	if cache.WaitForCacheSync(stopCh, w.pipeController.HasSynced, w.routeController.HasSynced) {
+		w.sync()
+	}
+
+	<-stopCh
+	logrus.WithFields(w.logContext).Debugln("stopped")
+}
+
+func (w *Watcher) sync() {
+	// wait for the initial lists, otherwise the routes would miss their pipes
+	if !w.pipeController.HasSynced() || !w.routeController.HasSynced() {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	resources := w.collect()
+	if w.last != nil && equalResources(w.last, resources) {
+		return
+	}
+
+	logrus.WithFields(w.logContext).Infof("synced %d pipes and %d scopes", len(resources.Pipes), len(resources.Scopes))
+	if err := w.onChange(resources); err != nil {
+		logrus.WithFields(w.logContext).WithError(err).Errorln("failed to apply the changed resources, retrying on the next resync")
+		return
+	}
+	w.last = resources
+}
+
+func (w *Watcher) collect() *Resources {
+	resources := &Resources{}
+	scopes := make(map[string]*routes.Scope)
+
+	for _, obj := range w.pipeStore.List() {
+		pipe := &EventExporterPipe{}
+		if err := fromUnstructured(obj, pipe); err != nil {
+			logrus.WithFields(w.logContext).WithError(err).Warnln("ignoring EventExporterPipe")
+			continue
+		}
+
+		pipeConfig, err := w.pipeConfig(pipe)
+		if err != nil {
+			logrus.WithFields(w.logContext).WithError(err).Warnf("ignoring EventExporterPipe %s/%s", pipe.Namespace, pipe.Name)
+			continue
+		}
+		resources.Pipes = append(resources.Pipes, *pipeConfig)
+
+		scope := scopes[pipe.Namespace]
+		if scope == nil {
+			scope = &routes.Scope{Cluster: w.cluster, Namespace: pipe.Namespace}
+			scopes[pipe.Namespace] = scope
+		}
+		scope.Pipes = append(scope.Pipes, pipeConfig.Name)
+	}
+
+	for _, obj := range w.routeStore.List() {
+		route := &EventRoute{}
+		if err := fromUnstructured(obj, route); err != nil {
+			logrus.WithFields(w.logContext).WithError(err).Warnln("ignoring EventRoute")
+			continue
+		}
+
+		rule, err := routeRule(route, scopes[route.Namespace])
+		if err != nil {
+			logrus.WithFields(w.logContext).WithError(err).Warnf("ignoring EventRoute %s/%s", route.Namespace, route.Name)
+			continue
+		}
+		scope := scopes[route.Namespace]
+		scope.Rules = append(scope.Rules, rule)
+	}
+
+	sort.Slice(resources.Pipes, func(i, j int) bool {
+		return resources.Pipes[i].Name < resources.Pipes[j].Name
+	})
+	for _, scope := range scopes {
+		resources.Scopes = append(resources.Scopes, scope)
+	}
+	sort.Slice(resources.Scopes, func(i, j int) bool {
+		return resources.Scopes[i].Namespace < resources.Scopes[j].Namespace
+	})
+
+	return resources
+}
+
+func (w *Watcher) pipeConfig(pipe *EventExporterPipe) (*config.PipeConfig, error) {
+	if _, ok := w.pipeTypes[pipe.Spec.Type]; !ok {
+		return nil, errors.NotSupportedf("pipe type %q", pipe.Spec.Type)
+	}
+
+	options := make(map[string]string, len(pipe.Spec.Options))
+	for key, value := range pipe.Spec.Options {
+		options[key] = value
+	}
+
+	if ref := pipe.Spec.SecretRef; ref != nil && len(ref.Name) != 0 {
+		secret, err := w.kclient.CoreV1().Secrets(pipe.Namespace).Get(ref.Name, apisMetaV1.GetOptions{})
+		if err != nil {
+			return nil, errors.Annotatef(err, "can't get Secret %s", ref.Name)
+		}
+		for key, value := range secret.Data {
+			options[key] = string(value)
+		}
+	}
+
+	for key := range options {
+		if strings.HasSuffix(key, fileOptionSuffix) {
+			return nil, errors.Errorf("option %s reads a file of the exporter, which is not allowed", key)
+		}
+	}
+
+	// the options never fall back to the envs, which may hold the credentials of the exporter
+	return &config.PipeConfig{
+		Name:    PipeName(pipe.Namespace, pipe.Name),
+		Type:    pipe.Spec.Type,
+		Options: options,
+		Scoped:  true,
+	}, nil
+}
+
+func routeRule(route *EventRoute, scope *routes.Scope) (*routes.Rule, error) {
+	if len(route.Spec.Pipes) == 0 {
+		return nil, errors.New("pipes are required")
+	}
+
+	rule := &routes.Rule{}
+	for _, name := range route.Spec.Pipes {
+		pipeName := PipeName(route.Namespace, name)
+
+		found := false
+		if scope != nil {
+			for _, owned := range scope.Pipes {
+				if owned == pipeName {
+					found = true
+					break
+				}
+			}
+		}
+		if !found {
+			return nil, errors.NotFoundf("EventExporterPipe %s", name)
+		}
+		rule.Pipes = append(rule.Pipes, pipeName)
+	}
+
+	if match := route.Spec.Match; match != nil {
+		rule.Match = &routes.Match{
+			Kinds:      match.Kinds,
+			Types:      match.Types,
+			Reasons:    match.Reasons,
+			Labels:     match.Labels,
+			Expression: match.Expression,
+		}
+	}
+
+	// validate the patterns before the rule joins the scope, so that a broken EventRoute
+	// doesn't break the others
+	if err := (&routes.Config{Rules: []*routes.Rule{rule}}).Validate(); err != nil {
+		return nil, err
+	}
+
+	return rule, nil
+}
+
+// PipeName names the pipe declared by an EventExporterPipe, which can't clash
+// with the others as the names of the configured pipes are free of slashes.
+func PipeName(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+func fromUnstructured(obj interface{}, into interface{}) error {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return errors.Errorf("unexpected object %T", obj)
+	}
+
+	// the json round trip compiles the expressions by their unmarshalers
+	data, err := u.MarshalJSON()
+	if err != nil {
+		return errors.Annotatef(err, "can't encode %s/%s", u.GetNamespace(), u.GetName())
+	}
+	if err := json.Unmarshal(data, into); err != nil {
+		return errors.Annotatef(err, "can't decode %s/%s", u.GetNamespace(), u.GetName())
+	}
+
+	return nil
+}
+
+// equalResources compares the resources by their json forms, as the compiled expressions
+// are not comparable.
+func equalResources(a, b *Resources) bool {
+	if !reflect.DeepEqual(a.Pipes, b.Pipes) {
+		return false
+	}
+
+	aScopes, aErr := json.Marshal(a.Scopes)
+	bScopes, bErr := json.Marshal(b.Scopes)
+	return aErr == nil && bErr == nil && string(aScopes) == string(bScopes)
+}
+
+func newInformer(client dynamic.Interface, resource schema.GroupVersionResource, resyncPeriod time.Duration, onChange func()) (cache.Store, cache.Controller) {
+	resources := client.Resource(resource).Namespace(apisMetaV1.NamespaceAll)
+	return cache.NewInformer(
+		&cache.ListWatch{
+			ListFunc: func(options apisMetaV1.ListOptions) (runtime.Object, error) {
+				return resources.List(options)
+			},
+			WatchFunc: func(options apisMetaV1.ListOptions) (watch.Interface, error) {
+				return resources.Watch(options)
+			},
+		},
+		&unstructured.Unstructured{},
+		resyncPeriod,
+		cache.ResourceEventHandlerFuncs{
+			AddFunc: func(interface{}) {
+				onChange()
+			},
+			UpdateFunc: func(interface{}, interface{}) {
+				onChange()
+			},
+			DeleteFunc: func(interface{}) {
+				onChange()
+			},
+		},
+	)
+}
+
+func NewWatcher(config *WatcherConfig) *Watcher {
+	w := &Watcher{
+		logContext: logger.CreateLogContext("CRDS", config.Cluster),
+
+		kclient:   config.KubeClient,
+		cluster:   config.Cluster,
+		pipeTypes: make(map[string]struct{}, len(config.PipeTypes)),
+		onChange:  config.OnChange,
+	}
+	for _, pipeType := range config.PipeTypes {
+		w.pipeTypes[pipeType] = struct{}{}
+	}
+
+	w.pipeStore, w.pipeController = newInformer(config.Client, EventExporterPipeResource, config.ResyncPeriod, w.sync)
+	w.routeStore, w.routeController = newInformer(config.Client, EventRouteResource, config.ResyncPeriod, w.sync)
+
+	return w
+}
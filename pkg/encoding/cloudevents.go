@@ -0,0 +1,149 @@
+package encoding
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	apiCoreV1 "k8s.io/api/core/v1"
+)
+
+const (
+	cloudEventsSpecVersion = "1.0"
+	cloudEventsContentType = "application/cloudevents+json"
+	cloudEventsTypePrefix  = "io.k8s.event."
+	cloudEventsTimeLayout  = time.RFC3339Nano
+)
+
+// cloudEventsEncoder encodes the event as a CloudEvents 1.0 event, whose data is
+// the json form of the event. The structured mode puts the attributes and the data
+// into a JSON envelope, the binary mode leaves the attributes to the transport headers.
+//
+// The attributes of an event are:
+//   - type: io.k8s.event.<type>.<reason>, e.g. io.k8s.event.warning.BackOff;
+//   - source: <cluster>/<namespace>/<kind>/<name> of the involved object,
+//     the namespace is omitted for a cluster scoped object;
+//   - subject: the uid of the involved object;
+//   - id: <uid>-<count> of the event, which is unique for each occurrence;
+//   - operation: the extension telling the change, e.g. add or delete.
+type cloudEventsEncoder struct {
+	cluster string
+	binary  bool
+}
+
+// cloudEvent is the JSON envelope of the structured mode.
+type cloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            string          `json:"time,omitempty"`
+	Operation       string          `json:"operation"`
+	DataContentType string          `json:"datacontenttype"`
+	Data            json.RawMessage `json:"data"`
+}
+
+func (e *cloudEventsEncoder) Encode(operation string, event *apiCoreV1.Event) (*Message, error) {
+	data, err := marshalEvent(event)
+	if err != nil {
+		return nil, err
+	}
+
+	// an event keeps its uid on recurring, the count tells the occurrences apart
+	ce := &cloudEvent{
+		SpecVersion:     cloudEventsSpecVersion,
+		ID:              string(event.UID) + "-" + strconv.Itoa(int(event.Count)),
+		Source:          e.source(event),
+		Type:            cloudEventsType(event),
+		Subject:         string(event.InvolvedObject.UID),
+		Operation:       operation,
+		DataContentType: jsonContentType,
+		Data:            data,
+	}
+	if t := eventTime(event); !t.IsZero() {
+		ce.Time = t.UTC().Format(cloudEventsTimeLayout)
+	}
+
+	if e.binary {
+		attributes := map[string]string{
+			"specversion": ce.SpecVersion,
+			"id":          ce.ID,
+			"source":      ce.Source,
+			"type":        ce.Type,
+			"operation":   ce.Operation,
+		}
+		if len(ce.Subject) != 0 {
+			attributes["subject"] = ce.Subject
+		}
+		if len(ce.Time) != 0 {
+			attributes["time"] = ce.Time
+		}
+
+		return &Message{
+			ContentType: jsonContentType,
+			Attributes:  attributes,
+			Data:        data,
+		}, nil
+	}
+
+	envelope, err := json.Marshal(ce)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Message{
+		ContentType: cloudEventsContentType,
+		Data:        envelope,
+	}, nil
+}
+
+func (e *cloudEventsEncoder) source(event *apiCoreV1.Event) string {
+	involvedObject := event.InvolvedObject
+
+	segments := []string{e.cluster}
+	if len(involvedObject.Namespace) != 0 {
+		segments = append(segments, involvedObject.Namespace)
+	}
+	segments = append(segments, involvedObject.Kind, involvedObject.Name)
+
+	return strings.Join(segments, "/")
+}
+
+func cloudEventsType(event *apiCoreV1.Event) string {
+	eventType := strings.ToLower(event.Type)
+	if len(eventType) == 0 {
+		eventType = strings.ToLower(apiCoreV1.EventTypeNormal)
+	}
+
+	return cloudEventsTypePrefix + eventType + "." + event.Reason
+}
+
+// eventTime is the last occurrence of the event, the events reported by
+// the events.k8s.io API may only have the event time.
+func eventTime(event *apiCoreV1.Event) time.Time {
+	switch {
+	case !event.LastTimestamp.IsZero():
+		return event.LastTimestamp.Time
+	case !event.EventTime.IsZero():
+		return event.EventTime.Time
+	}
+
+	return event.CreationTimestamp.Time
+}
+
+func newCloudEventsEncoder(config *Config, binary bool) *cloudEventsEncoder {
+	return &cloudEventsEncoder{
+		cluster: config.Cluster,
+		binary:  binary,
+	}
+}
+
+func newStructuredCloudEventsEncoder(config *Config) (Encoder, error) {
+	return newCloudEventsEncoder(config, false), nil
+}
+
+func newBinaryCloudEventsEncoder(config *Config) (Encoder, error) {
+	return newCloudEventsEncoder(config, true), nil
+}
@@ -0,0 +1,69 @@
+package encoding
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strconv"
+	"time"
+
+	apiCoreV1 "k8s.io/api/core/v1"
+)
+
+const csvContentType = "text/csv"
+
+// CSVColumns are the columns of a row encoded by the csv encoder,
+// the header is never written, as each event is encoded alone.
+var CSVColumns = []string{
+	"cluster", "operation", "namespace", "kind", "name", "type", "reason",
+	"message", "count", "firstTimestamp", "lastTimestamp", "uid",
+}
+
+type csvEncoder struct {
+	cluster string
+}
+
+func (e *csvEncoder) Encode(operation string, event *apiCoreV1.Event) (*Message, error) {
+	involvedObject := event.InvolvedObject
+
+	buf := &bytes.Buffer{}
+	w := csv.NewWriter(buf)
+	if err := w.Write([]string{
+		e.cluster,
+		operation,
+		involvedObject.Namespace,
+		involvedObject.Kind,
+		involvedObject.Name,
+		event.Type,
+		event.Reason,
+		event.Message,
+		strconv.Itoa(int(event.Count)),
+		csvTime(event.FirstTimestamp.Time),
+		csvTime(event.LastTimestamp.Time),
+		string(event.UID),
+	}); err != nil {
+		return nil, err
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, err
+	}
+
+	return &Message{
+		ContentType: csvContentType,
+		Data:        buf.Bytes(),
+	}, nil
+}
+
+func csvTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.UTC().Format(time.RFC3339)
+}
+
+func newCSVEncoder(config *Config) (Encoder, error) {
+	return &csvEncoder{
+		cluster: config.Cluster,
+	}, nil
+}
@@ -0,0 +1,71 @@
+package encoding
+
+import (
+	"sort"
+
+	"github.com/juju/errors"
+	apiCoreV1 "k8s.io/api/core/v1"
+)
+
+const (
+	JSON              = "json"
+	Protobuf          = "protobuf"
+	CloudEvents       = "cloudevents"
+	CloudEventsBinary = "cloudevents-binary"
+	CSV               = "csv"
+	Template          = "template"
+)
+
+// Message is an encoded event, the Attributes are only set by the encoders
+// which carry the metadata outside of the data, e.g. the CloudEvents binary mode,
+// each transport puts them into its own headers.
+type Message struct {
+	ContentType string
+	Attributes  map[string]string
+	Data        []byte
+}
+
+// Encoder turns an event into a message, the operation is one of add, update,
+// delete, expire or list. The event must not be changed, as it is shared by the pipes.
+type Encoder interface {
+	Encode(operation string, event *apiCoreV1.Event) (*Message, error)
+}
+
+type Config struct {
+	// Cluster is the name of the cluster which the events come from.
+	Cluster string
+	// Template is the text of the Go template used by the template encoder.
+	Template string
+}
+
+type factory func(config *Config) (Encoder, error)
+
+var factories = map[string]factory{
+	JSON:              newJSONEncoder,
+	Protobuf:          newProtobufEncoder,
+	CloudEvents:       newStructuredCloudEventsEncoder,
+	CloudEventsBinary: newBinaryCloudEventsEncoder,
+	CSV:               newCSVEncoder,
+	Template:          newTemplateEncoder,
+}
+
+// Names returns the sorted names of the encoders.
+func Names() []string {
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// New creates the encoder by name.
+func New(name string, config *Config) (Encoder, error) {
+	f, ok := factories[name]
+	if !ok {
+		return nil, errors.NotFoundf("encoder %s", name)
+	}
+
+	return f(config)
+}
@@ -0,0 +1,301 @@
+package encoding
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	apiCoreV1 "k8s.io/api/core/v1"
+	apisMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newTestEvent() *apiCoreV1.Event {
+	return &apiCoreV1.Event{
+		ObjectMeta: apisMetaV1.ObjectMeta{
+			Name:      "nginx.15f5b1",
+			Namespace: "default",
+			UID:       "e1",
+		},
+		InvolvedObject: apiCoreV1.ObjectReference{
+			Namespace: "default",
+			Kind:      "Pod",
+			Name:      "nginx",
+			UID:       "p1",
+		},
+		Reason:         "BackOff",
+		Message:        "Back-off restarting failed container",
+		Type:           apiCoreV1.EventTypeWarning,
+		Count:          3,
+		FirstTimestamp: apisMetaV1.NewTime(time.Date(2020, 1, 2, 3, 0, 0, 0, time.UTC)),
+		LastTimestamp:  apisMetaV1.NewTime(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)),
+	}
+}
+
+func TestNew(t *testing.T) {
+	for _, name := range Names() {
+		config := &Config{Cluster: "prod"}
+		if name == Template {
+			config.Template = "{{.Cluster}}"
+		}
+		if _, err := New(name, config); err != nil {
+			t.Errorf("can't create %s encoder: %v", name, err)
+		}
+	}
+
+	if _, err := New("xml", &Config{}); err == nil {
+		t.Error("expected error on unknown encoder")
+	}
+	if _, err := New(Template, &Config{}); err == nil {
+		t.Error("expected error on blank template")
+	}
+	if _, err := New(Template, &Config{Template: "{{.Cluster"}); err == nil {
+		t.Error("expected error on broken template")
+	}
+}
+
+func TestJSONEncoder(t *testing.T) {
+	event := newTestEvent()
+
+	msg, err := encode(t, JSON, &Config{}, "add", event)
+	if err != nil {
+		t.Fatalf("can't encode: %v", err)
+	}
+	if msg.ContentType != "application/json" {
+		t.Errorf("expected content type application/json but got %s", msg.ContentType)
+	}
+
+	decoded := &apiCoreV1.Event{}
+	if err := json.Unmarshal(msg.Data, decoded); err != nil {
+		t.Fatalf("can't decode: %v", err)
+	}
+	if decoded.APIVersion != "v1" || decoded.Kind != "Event" {
+		t.Errorf("expected type meta v1/Event but got %s/%s", decoded.APIVersion, decoded.Kind)
+	}
+	if decoded.UID != event.UID || decoded.Count != event.Count {
+		t.Errorf("expected event %s of count %d but got %s of count %d", event.UID, event.Count, decoded.UID, decoded.Count)
+	}
+	if len(event.Kind) != 0 {
+		t.Error("expected the shared event is unchanged")
+	}
+}
+
+func TestCloudEventsEncoder(t *testing.T) {
+	clusterScoped := newTestEvent()
+	clusterScoped.InvolvedObject = apiCoreV1.ObjectReference{Kind: "Node", Name: "node-1"}
+	clusterScoped.Type = ""
+
+	eventTimeOnly := newTestEvent()
+	eventTimeOnly.LastTimestamp = apisMetaV1.Time{}
+	eventTimeOnly.EventTime = apisMetaV1.NewMicroTime(time.Date(2020, 1, 2, 3, 4, 5, 6000, time.UTC))
+
+	tests := []struct {
+		name       string
+		operation  string
+		event      *apiCoreV1.Event
+		attributes map[string]string
+	}{
+		{
+			name:      "namespaced object",
+			operation: "add",
+			event:     newTestEvent(),
+			attributes: map[string]string{
+				"specversion": "1.0",
+				"id":          "e1-3",
+				"source":      "prod/default/Pod/nginx",
+				"type":        "io.k8s.event.warning.BackOff",
+				"subject":     "p1",
+				"time":        "2020-01-02T03:04:05Z",
+				"operation":   "add",
+			},
+		},
+		{
+			name:      "cluster scoped object without type",
+			operation: "delete",
+			event:     clusterScoped,
+			attributes: map[string]string{
+				"specversion": "1.0",
+				"id":          "e1-3",
+				"source":      "prod/Node/node-1",
+				"type":        "io.k8s.event.normal.BackOff",
+				"time":        "2020-01-02T03:04:05Z",
+				"operation":   "delete",
+			},
+		},
+		{
+			name:      "event time only",
+			operation: "update",
+			event:     eventTimeOnly,
+			attributes: map[string]string{
+				"specversion": "1.0",
+				"id":          "e1-3",
+				"source":      "prod/default/Pod/nginx",
+				"type":        "io.k8s.event.warning.BackOff",
+				"subject":     "p1",
+				"time":        "2020-01-02T03:04:05.000006Z",
+				"operation":   "update",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name+" in binary mode", func(t *testing.T) {
+			msg, err := encode(t, CloudEventsBinary, &Config{Cluster: "prod"}, tt.operation, tt.event)
+			if err != nil {
+				t.Fatalf("can't encode: %v", err)
+			}
+			if msg.ContentType != "application/json" {
+				t.Errorf("expected content type application/json but got %s", msg.ContentType)
+			}
+			if !reflect.DeepEqual(msg.Attributes, tt.attributes) {
+				t.Errorf("expected attributes %v but got %v", tt.attributes, msg.Attributes)
+			}
+
+			expected, _ := marshalEvent(tt.event)
+			if !bytes.Equal(msg.Data, expected) {
+				t.Errorf("expected data %s but got %s", expected, msg.Data)
+			}
+		})
+
+		t.Run(tt.name+" in structured mode", func(t *testing.T) {
+			msg, err := encode(t, CloudEvents, &Config{Cluster: "prod"}, tt.operation, tt.event)
+			if err != nil {
+				t.Fatalf("can't encode: %v", err)
+			}
+			if msg.ContentType != "application/cloudevents+json" {
+				t.Errorf("expected content type application/cloudevents+json but got %s", msg.ContentType)
+			}
+			if len(msg.Attributes) != 0 {
+				t.Errorf("expected no attributes but got %v", msg.Attributes)
+			}
+
+			envelope := map[string]interface{}{}
+			if err := json.Unmarshal(msg.Data, &envelope); err != nil {
+				t.Fatalf("can't decode envelope: %v", err)
+			}
+			for name, value := range tt.attributes {
+				if envelope[name] != value {
+					t.Errorf("expected %s %q but got %v", name, value, envelope[name])
+				}
+			}
+			if envelope["datacontenttype"] != "application/json" {
+				t.Errorf("expected datacontenttype application/json but got %v", envelope["datacontenttype"])
+			}
+			if _, ok := envelope["data"].(map[string]interface{}); !ok {
+				t.Errorf("expected data object but got %v", envelope["data"])
+			}
+		})
+	}
+}
+
+func TestCSVEncoder(t *testing.T) {
+	noTimes := newTestEvent()
+	noTimes.FirstTimestamp = apisMetaV1.Time{}
+	noTimes.LastTimestamp = apisMetaV1.Time{}
+	noTimes.Message = `quoted "message", with comma`
+
+	tests := []struct {
+		name     string
+		event    *apiCoreV1.Event
+		expected string
+	}{
+		{
+			name:     "plain",
+			event:    newTestEvent(),
+			expected: "prod,add,default,Pod,nginx,Warning,BackOff,Back-off restarting failed container,3,2020-01-02T03:00:00Z,2020-01-02T03:04:05Z,e1\n",
+		},
+		{
+			name:     "quoted without times",
+			event:    noTimes,
+			expected: "prod,add,default,Pod,nginx,Warning,BackOff,\"quoted \"\"message\"\", with comma\",3,,,e1\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := encode(t, CSV, &Config{Cluster: "prod"}, "add", tt.event)
+			if err != nil {
+				t.Fatalf("can't encode: %v", err)
+			}
+			if msg.ContentType != "text/csv" {
+				t.Errorf("expected content type text/csv but got %s", msg.ContentType)
+			}
+			if string(msg.Data) != tt.expected {
+				t.Errorf("expected\n%q\nbut got\n%q", tt.expected, msg.Data)
+			}
+		})
+	}
+}
+
+func TestTemplateEncoder(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		expected string
+		isErr    bool
+	}{
+		{
+			name:     "fields",
+			template: "{{.Cluster}} {{.Operation}} {{.Event.InvolvedObject.Name}}: {{.Event.Message}}",
+			expected: "prod update nginx: Back-off restarting failed container",
+		},
+		{
+			name:     "json function",
+			template: "{{json .Event.InvolvedObject.Kind}}",
+			expected: `"Pod"`,
+		},
+		{
+			name:     "missing field",
+			template: "{{.Unknown}}",
+			isErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := encode(t, Template, &Config{Cluster: "prod", Template: tt.template}, "update", newTestEvent())
+			if tt.isErr {
+				if err == nil {
+					t.Errorf("expected error but got %q", msg.Data)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("can't encode: %v", err)
+			}
+			if msg.ContentType != "text/plain" {
+				t.Errorf("expected content type text/plain but got %s", msg.ContentType)
+			}
+			if string(msg.Data) != tt.expected {
+				t.Errorf("expected %q but got %q", tt.expected, msg.Data)
+			}
+		})
+	}
+}
+
+func TestProtobufEncoder(t *testing.T) {
+	msg, err := encode(t, Protobuf, &Config{}, "add", newTestEvent())
+	if err != nil {
+		t.Fatalf("can't encode: %v", err)
+	}
+	if msg.ContentType != "application/vnd.kubernetes.protobuf" {
+		t.Errorf("expected content type application/vnd.kubernetes.protobuf but got %s", msg.ContentType)
+	}
+
+	// the Kubernetes protobuf envelope starts with the magic number
+	if !bytes.HasPrefix(msg.Data, []byte("k8s\x00")) {
+		t.Errorf("expected Kubernetes protobuf envelope but got %q", msg.Data)
+	}
+}
+
+func encode(t *testing.T, name string, config *Config, operation string, event *apiCoreV1.Event) (*Message, error) {
+	t.Helper()
+
+	encoder, err := New(name, config)
+	if err != nil {
+		t.Fatalf("can't create %s encoder: %v", name, err)
+	}
+
+	return encoder.Encode(operation, event)
+}
@@ -0,0 +1,42 @@
+package encoding
+
+import (
+	"encoding/json"
+
+	apiCoreV1 "k8s.io/api/core/v1"
+)
+
+const jsonContentType = "application/json"
+
+// jsonEncoder encodes the event as the Kubernetes API serves it,
+// including the apiVersion and the kind.
+type jsonEncoder struct{}
+
+func (jsonEncoder) Encode(_ string, event *apiCoreV1.Event) (*Message, error) {
+	data, err := marshalEvent(event)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Message{
+		ContentType: jsonContentType,
+		Data:        data,
+	}, nil
+}
+
+func newJSONEncoder(_ *Config) (Encoder, error) {
+	return jsonEncoder{}, nil
+}
+
+// marshalEvent sets the type meta on a copy, the events from the informer lack it.
+func marshalEvent(event *apiCoreV1.Event) ([]byte, error) {
+	return json.Marshal(typedEvent(event))
+}
+
+func typedEvent(event *apiCoreV1.Event) *apiCoreV1.Event {
+	typed := event.DeepCopy()
+	typed.APIVersion = apiCoreV1.SchemeGroupVersion.String()
+	typed.Kind = "Event"
+
+	return typed
+}
@@ -0,0 +1,40 @@
+package encoding
+
+import (
+	"github.com/juju/errors"
+	apiCoreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+const protobufContentType = "application/vnd.kubernetes.protobuf"
+
+// protobufEncoder encodes the event in the Kubernetes protobuf envelope,
+// which can be decoded by the Kubernetes codecs.
+type protobufEncoder struct {
+	encoder runtime.Encoder
+}
+
+func (e *protobufEncoder) Encode(_ string, event *apiCoreV1.Event) (*Message, error) {
+	// the codec sets the type meta during encoding, so encode a copy
+	data, err := runtime.Encode(e.encoder, event.DeepCopy())
+	if err != nil {
+		return nil, err
+	}
+
+	return &Message{
+		ContentType: protobufContentType,
+		Data:        data,
+	}, nil
+}
+
+func newProtobufEncoder(_ *Config) (Encoder, error) {
+	info, ok := runtime.SerializerInfoForMediaType(scheme.Codecs.SupportedMediaTypes(), protobufContentType)
+	if !ok {
+		return nil, errors.NotSupportedf("media type %s", protobufContentType)
+	}
+
+	return &protobufEncoder{
+		encoder: scheme.Codecs.EncoderForVersion(info.Serializer, apiCoreV1.SchemeGroupVersion),
+	}, nil
+}
@@ -0,0 +1,64 @@
+package encoding
+
+import (
+	"bytes"
+	"encoding/json"
+	"text/template"
+
+	"github.com/juju/errors"
+	apiCoreV1 "k8s.io/api/core/v1"
+)
+
+const templateContentType = "text/plain"
+
+// TemplateData is the data which the template executes on,
+// e.g. "{{.Cluster}}/{{.Event.InvolvedObject.Name}}: {{.Event.Message}}".
+type TemplateData struct {
+	Cluster   string
+	Operation string
+	Event     *apiCoreV1.Event
+}
+
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+type templateEncoder struct {
+	cluster  string
+	template *template.Template
+}
+
+func (e *templateEncoder) Encode(operation string, event *apiCoreV1.Event) (*Message, error) {
+	buf := &bytes.Buffer{}
+	if err := e.template.Execute(buf, &TemplateData{
+		Cluster:   e.cluster,
+		Operation: operation,
+		Event:     event,
+	}); err != nil {
+		return nil, errors.Annotate(err, "can't execute template")
+	}
+
+	return &Message{
+		ContentType: templateContentType,
+		Data:        buf.Bytes(),
+	}, nil
+}
+
+func newTemplateEncoder(config *Config) (Encoder, error) {
+	if len(config.Template) == 0 {
+		return nil, errors.New("template is required")
+	}
+
+	tmpl, err := template.New("event").Funcs(templateFuncs).Option("missingkey=error").Parse(config.Template)
+	if err != nil {
+		return nil, errors.Annotate(err, "can't parse template")
+	}
+
+	return &templateEncoder{
+		cluster:  config.Cluster,
+		template: tmpl,
+	}, nil
+}
@@ -14,6 +14,12 @@ type EventHandler interface {
 	OnDelete(*apiCoreV1.Event)
 }
 
+// ExpirationHandler can be implemented by the EventHandler to be notified of
+// the events which are removed by the storage TTL rather than the API.
+type ExpirationHandler interface {
+	OnExpire(*apiCoreV1.Event)
+}
+
 type eventHandlerWrapper struct {
 	handler EventHandler
 }
@@ -60,6 +66,17 @@ func (c *eventHandlerWrapper) OnDelete(obj interface{}) {
 	c.handler.OnDelete(event)
 }
 
+func (c *eventHandlerWrapper) OnExpire(obj interface{}) {
+	expirationHandler, ok := c.handler.(ExpirationHandler)
+	if !ok {
+		return
+	}
+
+	if event, ok := c.convert(obj); ok {
+		expirationHandler.OnExpire(event)
+	}
+}
+
 func (c *eventHandlerWrapper) convert(obj interface{}) (*apiCoreV1.Event, bool) {
 	if event, ok := obj.(*apiCoreV1.Event); ok {
 		return event, true
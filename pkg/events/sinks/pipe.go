@@ -1,15 +1,25 @@
 package sinks
 
 import (
+	"context"
+
 	apiCoreV1 "k8s.io/api/core/v1"
 )
 
 type Pipe interface {
 	Start() error
-	Stop()
+	// Stop flushes the queued events until the context is done,
+	// and returns the count of the dropped events.
+	Stop(ctx context.Context) int
 
 	OnAdd(event *apiCoreV1.Event) error
 	OnUpdate(oldEvent *apiCoreV1.Event, newEvent *apiCoreV1.Event) error
 	OnDelete(event *apiCoreV1.Event) error
 	OnList(eventList *apiCoreV1.EventList) error
 }
+
+// ExpirationPipe can be implemented by the Pipe to be notified of the events
+// which are removed by the storage TTL rather than deleted by the API.
+type ExpirationPipe interface {
+	OnExpire(event *apiCoreV1.Event) error
+}
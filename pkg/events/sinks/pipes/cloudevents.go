@@ -0,0 +1,335 @@
+package pipes
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/encoding"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/utils/logger"
+	apiCoreV1 "k8s.io/api/core/v1"
+)
+
+const (
+	CloudEventsURLEnvKey                   = "PIPE_CLOUDEVENTS_URL"
+	CloudEventsModeEnvKey                  = "PIPE_CLOUDEVENTS_MODE"
+	CloudEventsRetriesEnvKey               = "PIPE_CLOUDEVENTS_RETRIES"
+	CloudEventsTimeoutEnvKey               = "PIPE_CLOUDEVENTS_TIMEOUT"
+	CloudEventsTLSCAFileEnvKey             = "PIPE_CLOUDEVENTS_TLS_CA_FILE"
+	CloudEventsTLSInsecureSkipVerifyEnvKey = "PIPE_CLOUDEVENTS_TLS_INSECURE_SKIP_VERIFY"
+
+	cloudEventsModeBinary     = "binary"
+	cloudEventsModeStructured = "structured"
+
+	cloudEventsHeaderPrefix   = "ce-"
+	cloudEventsDefaultRetries = 3
+	cloudEventsDefaultTimeout = 10 * time.Second
+	cloudEventsRetryBackoff   = 1 * time.Second
+	cloudEventsQueueSize      = 1 << 16
+)
+
+type cloudEventsUnit struct {
+	uid     string
+	encoded *encoding.Message
+}
+
+// cloudEventsPipe posts each change of the events as a CloudEvent to a HTTP sink,
+// e.g. a Knative broker or an Argo Events webhook. The events are queued and posted
+// in order by a worker, the failed deliveries are retried with an exponential backoff,
+// except the ones rejected by the sink. The events are dropped if the queue is full,
+// so that a slow sink never blocks the watching, or if they can't be delivered at last.
+type cloudEventsPipe struct {
+	logContext logrus.Fields
+	cluster    string
+	options    Options
+
+	rootCtx        context.Context
+	rootCancelFunc context.CancelFunc
+	eventChan      chan cloudEventsUnit
+	eventChanDone  chan struct{}
+	eventChanDrop  int32
+	dropped        int64
+	stopping       bool
+
+	url     string
+	client  *http.Client
+	encoder encoding.Encoder
+	retries int
+
+	stopOnce sync.Once
+
+	sync.RWMutex
+	sync.Once
+}
+
+func (p *cloudEventsPipe) Start() (err error) {
+	p.Do(func() {
+		logrus.WithFields(p.logContext).Debugln("starting")
+
+		// the queue is never consumed if the starting fails
+		defer func() {
+			if err != nil {
+				close(p.eventChanDone)
+			}
+		}()
+
+		p.url = p.options.Get(CloudEventsURLEnvKey)
+		if len(p.url) == 0 {
+			err = errors.Errorf(`"%s" option is required`, CloudEventsURLEnvKey)
+			return
+		}
+
+		encoderName := encoding.CloudEventsBinary
+		mode := strings.ToLower(p.options.Get(CloudEventsModeEnvKey))
+		switch mode {
+		case "", cloudEventsModeBinary:
+			mode = cloudEventsModeBinary
+		case cloudEventsModeStructured:
+			encoderName = encoding.CloudEvents
+		default:
+			err = errors.Errorf(`"%s" option only supports binary or structured, but got %s`, CloudEventsModeEnvKey, mode)
+			return
+		}
+		p.encoder, err = encoding.New(encoderName, &encoding.Config{Cluster: p.cluster})
+		if err != nil {
+			return
+		}
+
+		p.retries = cloudEventsDefaultRetries
+		if retries := p.options.Get(CloudEventsRetriesEnvKey); len(retries) != 0 {
+			p.retries, err = strconv.Atoi(retries)
+			if err != nil || p.retries < 0 {
+				err = errors.Errorf(`"%s" option must be a non-negative number`, CloudEventsRetriesEnvKey)
+				return
+			}
+		}
+
+		timeout := cloudEventsDefaultTimeout
+		if t := p.options.Get(CloudEventsTimeoutEnvKey); len(t) != 0 {
+			timeout, err = time.ParseDuration(t)
+			if err != nil {
+				err = errors.Annotatef(err, `can't parse "%s" option`, CloudEventsTimeoutEnvKey)
+				return
+			}
+		}
+
+		tlsConfig := &tls.Config{
+			InsecureSkipVerify: strings.ToLower(p.options.Get(CloudEventsTLSInsecureSkipVerifyEnvKey)) == "true",
+		}
+		if caFile := p.options.Get(CloudEventsTLSCAFileEnvKey); len(caFile) != 0 {
+			caBytes, caErr := ioutil.ReadFile(caFile)
+			if caErr != nil {
+				err = errors.Annotatef(caErr, "can't read %s", caFile)
+				return
+			}
+
+			tlsConfig.RootCAs = x509.NewCertPool()
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(caBytes) {
+				err = errors.Errorf("can't parse any certificate from %s", caFile)
+				return
+			}
+		}
+
+		p.client = &http.Client{
+			Timeout: timeout,
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: tlsConfig,
+			},
+		}
+
+		go p.dealEventChan()
+
+		logrus.WithFields(p.logContext).Debugf("posting to %s in %s mode", p.url, mode)
+	})
+
+	return err
+}
+
+func (p *cloudEventsPipe) Stop(ctx context.Context) int {
+	p.stopOnce.Do(func() {
+		logrus.WithFields(p.logContext).Debugln("stopping")
+
+		// a pipe which has never started can't start anymore, and has nothing to consume
+		p.Do(func() {
+			close(p.eventChanDone)
+		})
+
+		// refuse the new events and close the queue, the queued events
+		// are posted until the context is done
+		p.Lock()
+		p.stopping = true
+		close(p.eventChan)
+		p.Unlock()
+
+		select {
+		case <-p.eventChanDone:
+		case <-ctx.Done():
+			// drop the remaining events and abort the retrying
+			atomic.StoreInt32(&p.eventChanDrop, 1)
+			p.rootCancelFunc()
+			<-p.eventChanDone
+		}
+
+		p.rootCancelFunc()
+		if p.client != nil {
+			if transport, ok := p.client.Transport.(*http.Transport); ok {
+				transport.CloseIdleConnections()
+			}
+		}
+
+		logrus.WithFields(p.logContext).Debugf("stopped, dropped %d events", atomic.LoadInt64(&p.dropped))
+	})
+
+	return int(atomic.LoadInt64(&p.dropped))
+}
+
+func (p *cloudEventsPipe) OnAdd(event *apiCoreV1.Event) error {
+	return p.post("add", event)
+}
+
+func (p *cloudEventsPipe) OnUpdate(_ *apiCoreV1.Event, event *apiCoreV1.Event) error {
+	return p.post("update", event)
+}
+
+func (p *cloudEventsPipe) OnDelete(event *apiCoreV1.Event) error {
+	return p.post("delete", event)
+}
+
+// OnExpire implements the sinks.ExpirationPipe.
+func (p *cloudEventsPipe) OnExpire(event *apiCoreV1.Event) error {
+	return p.post("expire", event)
+}
+
+func (p *cloudEventsPipe) OnList(eventList *apiCoreV1.EventList) error {
+	for i := range eventList.Items {
+		if err := p.post("list", &eventList.Items[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// post encodes the event and queues it for the worker.
+func (p *cloudEventsPipe) post(operation string, event *apiCoreV1.Event) error {
+	encoded, err := p.encoder.Encode(operation, event)
+	if err != nil {
+		return err
+	}
+
+	p.RLock()
+	defer p.RUnlock()
+
+	if p.stopping {
+		atomic.AddInt64(&p.dropped, 1)
+		return errors.New("pipe is stopping")
+	}
+
+	select {
+	case p.eventChan <- cloudEventsUnit{uid: string(event.UID), encoded: encoded}:
+		return nil
+	default:
+		atomic.AddInt64(&p.dropped, 1)
+		return errors.Errorf("dropping event %s, as the queue is full", event.UID)
+	}
+}
+
+func (p *cloudEventsPipe) dealEventChan() {
+	defer close(p.eventChanDone)
+
+	for unit := range p.eventChan {
+		if atomic.LoadInt32(&p.eventChanDrop) == 1 {
+			atomic.AddInt64(&p.dropped, 1)
+			continue
+		}
+
+		// the undelivered events are counted as dropped, including the aborted ones
+		if err := p.deliver(&unit); err != nil {
+			atomic.AddInt64(&p.dropped, 1)
+			logrus.WithFields(p.logContext).WithError(err).Errorf("failed to post event %s", unit.uid)
+		}
+	}
+}
+
+func (p *cloudEventsPipe) deliver(unit *cloudEventsUnit) error {
+	var lastErr error
+	for i := 0; i <= p.retries; i++ {
+		if i != 0 {
+			select {
+			case <-p.rootCtx.Done():
+				return errors.Annotatef(lastErr, "aborted posting to %s", p.url)
+			case <-time.After(cloudEventsRetryBackoff << uint(i-1)):
+			}
+		}
+
+		retryable, err := p.postOnce(unit.encoded)
+		if err == nil {
+			return nil
+		}
+		if !retryable {
+			return err
+		}
+		lastErr = err
+		logrus.WithFields(p.logContext).WithError(err).Debugf("retrying to post event %s", unit.uid)
+	}
+
+	return errors.Annotatef(lastErr, "can't post to %s after %d retries", p.url, p.retries)
+}
+
+// postOnce tells whether the failure is retryable, the sink may recover from
+// the network errors, the server errors and the throttling.
+func (p *cloudEventsPipe) postOnce(encoded *encoding.Message) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, p.url, bytes.NewReader(encoded.Data))
+	if err != nil {
+		return false, err
+	}
+	req = req.WithContext(p.rootCtx)
+	req.Header.Set("Content-Type", encoded.ContentType)
+	for name, value := range encoded.Attributes {
+		req.Header.Set(cloudEventsHeaderPrefix+name, value)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	// drain the body for reusing the connection
+	io.Copy(ioutil.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, errors.Errorf("sink responded %s", resp.Status)
+	}
+
+	return false, errors.Errorf("sink rejected with %s", resp.Status)
+}
+
+func NewCloudEvents(name, cluster string, options Options) *cloudEventsPipe {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+
+	return &cloudEventsPipe{
+		logContext: logger.CreateLogContext("PIPE<"+name+">", cluster),
+		cluster:    cluster,
+		options:    options,
+
+		rootCtx:        ctx,
+		rootCancelFunc: cancelFunc,
+		eventChan:      make(chan cloudEventsUnit, cloudEventsQueueSize),
+		eventChanDone:  make(chan struct{}),
+	}
+}
@@ -0,0 +1,37 @@
+package pipes
+
+import (
+	"github.com/juju/errors"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/encoding"
+)
+
+// encodingTemplateKeySuffix names the option holding the template of the template
+// encoding, e.g. PIPE_NATS_ENCODING_TEMPLATE, which can be read from a file as well.
+const encodingTemplateKeySuffix = "_TEMPLATE"
+
+// newEncoder creates the encoder named by the option of the key, a blank option means
+// the fallback encoding, and a blank fallback means the pipe keeps its own format.
+func newEncoder(options Options, key, cluster, fallback string) (encoding.Encoder, error) {
+	name := options.Get(key)
+	if len(name) == 0 {
+		name = fallback
+	}
+	if len(name) == 0 {
+		return nil, nil
+	}
+
+	tmpl, err := options.GetWithFile(key + encodingTemplateKeySuffix)
+	if err != nil {
+		return nil, err
+	}
+
+	encoder, err := encoding.New(name, &encoding.Config{
+		Cluster:  cluster,
+		Template: tmpl,
+	})
+	if err != nil {
+		return nil, errors.Annotatef(err, `can't create encoder by "%s" option`, key)
+	}
+
+	return encoder, nil
+}
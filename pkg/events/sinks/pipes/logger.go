@@ -1,50 +1,85 @@
 package pipes
 
 import (
+	"context"
 	"sync"
 
 	"github.com/sirupsen/logrus"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/encoding"
 	"github.com/thxcode/kubernetes-event-exporter/pkg/utils/logger"
 	apiCoreV1 "k8s.io/api/core/v1"
 )
 
+const LoggerEncodingEnvKey = "PIPE_LOGGER_ENCODING"
+
 type loggerPipe struct {
 	logContext logrus.Fields
+	cluster    string
+	options    Options
+
+	// encoder encodes the logged events, nil means printing them as a table
+	encoder encoding.Encoder
 
 	sync.Once
 }
 
-func (p *loggerPipe) Start() error {
+func (p *loggerPipe) Start() (err error) {
 	p.Do(func() {
 		logrus.WithFields(p.logContext).Debugln("starting")
+
+		p.encoder, err = newEncoder(p.options, LoggerEncodingEnvKey, p.cluster, "")
 	})
 
-	return nil
+	return err
 }
 
-func (p *loggerPipe) Stop() {
+func (p *loggerPipe) Stop(_ context.Context) int {
 	logrus.WithFields(p.logContext).Debugln("stopped")
+
+	return 0
 }
 
 func (p *loggerPipe) OnAdd(event *apiCoreV1.Event) error {
+	if p.encoder != nil {
+		return p.logEncoded("OnAdd", "add", event)
+	}
+
 	logrus.WithFields(p.logContext).WithField("operation", "OnAdd").Debugln(showHead(printEvent(inState, event)))
 
 	return nil
 }
 
 func (p *loggerPipe) OnUpdate(oldEvent *apiCoreV1.Event, newEvent *apiCoreV1.Event) error {
+	if p.encoder != nil {
+		return p.logEncoded("OnUpdate", "update", newEvent)
+	}
+
 	logrus.WithFields(p.logContext).WithField("operation", "OnUpdate").Debugln(showHead(printEvent(outState, oldEvent), printEvent(inState, newEvent)))
 
 	return nil
 }
 
 func (p *loggerPipe) OnDelete(event *apiCoreV1.Event) error {
+	if p.encoder != nil {
+		return p.logEncoded("OnDelete", "delete", event)
+	}
+
 	logrus.WithFields(p.logContext).WithField("operation", "OnDelete").Debugln(showHead(printEvent(outState, event)))
 
 	return nil
 }
 
 func (p *loggerPipe) OnList(eventList *apiCoreV1.EventList) error {
+	if p.encoder != nil {
+		for i := range eventList.Items {
+			if err := p.logEncoded("OnList", "list", &eventList.Items[i]); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
 	if len(eventList.Items) != 0 {
 		logrus.WithFields(p.logContext).WithField("operation", "OnList").Debugln(showHead(printEventList(eventList)))
 	}
@@ -52,8 +87,21 @@ func (p *loggerPipe) OnList(eventList *apiCoreV1.EventList) error {
 	return nil
 }
 
-func NewLogger(khost string) *loggerPipe {
+func (p *loggerPipe) logEncoded(handle, operation string, event *apiCoreV1.Event) error {
+	encoded, err := p.encoder.Encode(operation, event)
+	if err != nil {
+		return err
+	}
+
+	logrus.WithFields(p.logContext).WithField("operation", handle).Debugln(string(encoded.Data))
+
+	return nil
+}
+
+func NewLogger(name, cluster string, options Options) *loggerPipe {
 	return &loggerPipe{
-		logContext: logger.CreateLogContext("PIPE<logger>", khost),
+		logContext: logger.CreateLogContext("PIPE<"+name+">", cluster),
+		cluster:    cluster,
+		options:    options,
 	}
 }
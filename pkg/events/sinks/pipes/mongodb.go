@@ -4,23 +4,21 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
-	"encoding/json"
 	"fmt"
-	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
-	"unsafe"
 
 	"github.com/juju/errors"
-	"github.com/mongodb/mongo-go-driver/bson"
-	"github.com/mongodb/mongo-go-driver/core/option"
-	"github.com/mongodb/mongo-go-driver/mongo"
 	"github.com/sirupsen/logrus"
 	"github.com/thxcode/kubernetes-event-exporter/pkg/events/sinks"
 	"github.com/thxcode/kubernetes-event-exporter/pkg/utils/logger"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	apiCoreV1 "k8s.io/api/core/v1"
-	apisMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 )
 
@@ -28,30 +26,55 @@ const (
 	MongodbConnectURIEnvKey       = "PIPE_MONGODB_CONNECT_URI"
 	MongodbDatabaseNameEnvKey     = "PIPE_MONGODB_DATABASE_NAME"
 	MongodbEnableJsonAttachEnvKey = "PIPE_MONGODB_ENABLE_JSON_ATTACH"
-
-	dataOpenIdKey     = "_id"
-	dataAttachJsonKey = "_attachJson"
-	dataAttachDocKey  = "_attachDoc"
+	MongodbEnableLifecycleEnvKey  = "PIPE_MONGODB_ENABLE_LIFECYCLE"
+
+	dataOpenIdKey        = "_id"
+	dataAttachJsonKey    = "_attachJson"
+	dataAttachDocKey     = "_attachDoc"
+	dataDeletedAtKey     = "deletedAt"
+	dataDeletionCauseKey = "deletionCause"
+	dataHistoryKey       = "history"
+
+	// deletionCauseDeleted means the event was deleted by the API, e.g. garbage-collected by Kubernetes.
+	deletionCauseDeleted = "deleted"
+	// deletionCauseExpired means the event aged out of the storage TTL of the exporter.
+	deletionCauseExpired = "expired"
 )
 
 type eventChanUnit struct {
-	eventBson   *bson.Document
+	event       *apiCoreV1.Event
 	eventHandle sinks.Handle
+	// attachJson or attachDoc is the involved object info, which is only set on inserting
+	attachJson string
+	attachDoc  bson.D
+	// history is the history entry to record, only used with the lifecycle enabled
+	history *mongodbHistory
 }
 
 type mongodbPipe struct {
 	logContext logrus.Fields
+	khost      string
+	options    Options
 
 	rootCtx        context.Context
 	rootCancelFunc context.CancelFunc
 	eventChan      chan eventChanUnit
-	eventChanStop  chan chan struct{}
-	kclient        kubernetes.Interface
+	eventChanDone  chan struct{}
+	eventChanDrop  int32
+	dropped        int64
+	stopping       bool
+	attacher       *mongodbAttacher
 
 	mongoCollection  *mongo.Collection
 	mongoDatabase    *mongo.Database
 	mongoClient      *mongo.Client
 	enableJsonAttach bool
+	enableLifecycle  bool
+	kinds            *mongodbKinds
+	retention        *mongodbRetention
+	operationTimeout time.Duration
+
+	stopOnce sync.Once
 
 	sync.RWMutex
 	sync.Once
@@ -61,31 +84,72 @@ func (p *mongodbPipe) Start() (err error) {
 	p.Do(func() {
 		logrus.WithFields(p.logContext).Debugln("starting")
 
-		uri := os.Getenv(MongodbConnectURIEnvKey)
-		if len(uri) == 0 {
-			err = errors.Errorf(`"%s" env is required`, MongodbConnectURIEnvKey)
+		// the queue is never consumed if the starting fails
+		defer func() {
+			if err != nil {
+				close(p.eventChanDone)
+			}
+		}()
+
+		uri, uriErr := mongodbConnectURI(p.options)
+		if uriErr != nil {
+			err = uriErr
 			return
 		} else {
-			enableJsonAttachEnv := os.Getenv(MongodbEnableJsonAttachEnvKey)
+			p.operationTimeout, err = mongodbOperationTimeout(p.options)
+			if err != nil {
+				return
+			}
+
+			p.kinds = parseMongodbKinds(p.options)
+
+			// Pods and Nodes are always attached, the other kinds are disabled by default,
+			// as they are got by the dynamic client with the permissions of the exporter
+			enableAttachEnv := p.options.Get(MongodbEnableAttachEnvKey)
+			p.attacher.enableDynamic = strings.ToLower(enableAttachEnv) == "true"
+			if p.attacher.enableDynamic {
+				logrus.WithFields(p.logContext).Debugln("enabling involved object info attaching of all kinds")
+			}
+
+			enableJsonAttachEnv := p.options.Get(MongodbEnableJsonAttachEnvKey)
 			p.enableJsonAttach = strings.ToLower(enableJsonAttachEnv) == "true"
 			if p.enableJsonAttach {
-				logrus.WithFields(p.logContext).Debugln("enabling Pod or Node info json form attaching")
+				logrus.WithFields(p.logContext).Debugln("enabling involved object info json form attaching")
 			}
 
-			p.mongoClient, err = mongo.Connect(p.rootCtx, uri, nil)
+			enableLifecycleEnv := p.options.Get(MongodbEnableLifecycleEnvKey)
+			p.enableLifecycle = strings.ToLower(enableLifecycleEnv) == "true"
+			if p.enableLifecycle {
+				logrus.WithFields(p.logContext).Debugln("enabling event lifecycle recording")
+			}
+
+			p.retention, err = parseMongodbRetention(p.options)
 			if err != nil {
-				err = errors.Annotate(err, "MongoDB fail to create client")
+				return
+			}
+			if p.enableLifecycle && p.retention.collectionType != mongodbCollectionStandard {
+				err = errors.Errorf(`"%s" option requires standard collection`, MongodbEnableLifecycleEnvKey)
 				return
 			}
 
-			dbname := os.Getenv(MongodbDatabaseNameEnvKey)
-			if len(dbname) == 0 {
-				dbname = "kubernetes_events"
+			p.mongoClient, err = mongo.Connect(p.rootCtx, options.Client().
+				ApplyURI(uri).
+				SetRegistry(mongodbRegistry).
+				SetRetryWrites(true).
+				SetRetryReads(true),
+			)
+			if err != nil {
+				err = errors.Annotate(err, "MongoDB fail to create client")
+				return
 			}
+
+			dbname := mongodbDatabaseName(p.options)
 			p.mongoDatabase = p.mongoClient.Database(dbname)
 			logrus.WithFields(p.logContext).Debugf("using %s database", dbname)
 
-			khost := (p.logContext[logger.LogKubernetesHostKey]).(string)
+			// the collections are mapped by the Kubernetes host rather than the cluster name,
+			// so that the stored events are kept when the cluster is renamed
+			khost := p.khost
 			if len(khost) == 0 {
 				err = errors.Errorf("can't get Kubernetes host")
 				return
@@ -93,106 +157,76 @@ func (p *mongodbPipe) Start() (err error) {
 
 			// get mongodb collection name
 			collectionsMapCollection := p.mongoDatabase.Collection("collections_map")
-			collectionsMapCollection.Indexes().CreateMany(p.rootCtx, nil,
-				mongo.IndexModel{
-					Keys: bson.NewDocument(
-						bson.EC.Int64("kubernetes_host", 1),
-					),
-					Options: bson.NewDocument(
-						bson.EC.Boolean("background", true),
-						bson.EC.Boolean("unique", true),
-						bson.EC.String("name", "khost"),
-					),
+			collectionsMapCollection.Indexes().CreateMany(p.rootCtx, []mongo.IndexModel{
+				{
+					Keys:    bson.D{{Key: "kubernetes_host", Value: 1}},
+					Options: options.Index().SetBackground(true).SetUnique(true).SetName("khost"),
 				},
-				mongo.IndexModel{
-					Keys: bson.NewDocument(
-						bson.EC.Int64("collection_name", 1),
-					),
-					Options: bson.NewDocument(
-						bson.EC.Boolean("background", true),
-						bson.EC.Boolean("unique", true),
-						bson.EC.String("name", "colname"),
-					),
+				{
+					Keys:    bson.D{{Key: "collection_name", Value: 1}},
+					Options: options.Index().SetBackground(true).SetUnique(true).SetName("colname"),
 				},
-			)
+			})
 
-			docResult := collectionsMapCollection.FindOne(
+			storageCollectionMap := struct {
+				CollectionName string `bson:"collection_name"`
+			}{}
+			if err = collectionsMapCollection.FindOne(
 				p.rootCtx,
-				bson.NewDocument(
-					bson.EC.String("kubernetes_host", khost),
-				),
-			)
-			colname := ""
-			storageCollectionMap := bson.NewDocument()
-
-			if err := docResult.Decode(storageCollectionMap); err != nil {
+				bson.M{"kubernetes_host": khost},
+			).Decode(&storageCollectionMap); err != nil {
 				if err != mongo.ErrNoDocuments {
 					err = errors.Annotatef(err, "can't find info from %s.collections_map collection", dbname)
 					return
-				} else {
-					colname = hashing([]byte(khost))[:16]
-					if _, err = collectionsMapCollection.InsertOne(
-						p.rootCtx,
-						bson.NewDocument(
-							bson.EC.String("kubernetes_host", khost),
-							bson.EC.String("collection_name", colname),
-						),
-					); err != nil {
-						err = errors.Annotatef(err, "can't insert info into %s.collections_map collection", dbname)
-						return
-					}
 				}
-			} else {
-				if colnameVal := storageCollectionMap.Lookup("collection_name"); colnameVal == nil {
-					err = errors.Annotatef(err, "can't find collection_name column on %s.collections_map collection schema", dbname)
+
+				storageCollectionMap.CollectionName = hashing([]byte(khost))[:16]
+				if _, err = collectionsMapCollection.InsertOne(
+					p.rootCtx,
+					bson.M{
+						"kubernetes_host": khost,
+						"collection_name": storageCollectionMap.CollectionName,
+					},
+				); err != nil {
+					err = errors.Annotatef(err, "can't insert info into %s.collections_map collection", dbname)
 					return
-				} else {
-					colname = colnameVal.StringValue()
 				}
 			}
 
+			colname := storageCollectionMap.CollectionName
 			if len(colname) == 0 {
 				err = errors.New(fmt.Sprintf("can't use blank collection name for %s", khost))
 				return
 			}
 
+			if err = p.retention.ensureCollection(p.rootCtx, p.logContext, p.mongoDatabase, colname); err != nil {
+				return
+			}
+
 			p.mongoCollection = p.mongoDatabase.Collection(colname)
-			p.mongoCollection.Indexes().CreateMany(p.rootCtx, nil,
-				mongo.IndexModel{
-					Keys: bson.NewDocument(
-						bson.EC.Int64("metadata.uid", 1),
-					),
-					Options: bson.NewDocument(
-						bson.EC.Boolean("background", true),
-						bson.EC.Boolean("unique", true),
-						bson.EC.String("name", "query_id"),
-					),
+			p.mongoCollection.Indexes().CreateMany(p.rootCtx, []mongo.IndexModel{
+				{
+					Keys: bson.D{{Key: "metadata.uid", Value: 1}},
+					// a time-series collection records the same event many times
+					Options: options.Index().SetBackground(true).SetUnique(!p.retention.isTimeseries()).SetName("query_id"),
 				},
-				mongo.IndexModel{
-					Keys: bson.NewDocument(
-						bson.EC.Int64("involvedObject.kind", 1),
-						bson.EC.Int64("involvedObject.name", 1),
-						bson.EC.Int64("involvedObject.namespace", 1),
-					),
-					Options: bson.NewDocument(
-						bson.EC.Boolean("background", true),
-						bson.EC.Boolean("unique", false),
-						bson.EC.Boolean("sparse", true),
-						bson.EC.String("name", "query_info"),
-					),
+				{
+					Keys: bson.D{
+						{Key: "involvedObject.kind", Value: 1},
+						{Key: "involvedObject.name", Value: 1},
+						{Key: "involvedObject.namespace", Value: 1},
+					},
+					Options: options.Index().SetBackground(true).SetSparse(true).SetName("query_info"),
 				},
-				mongo.IndexModel{
-					Keys: bson.NewDocument(
-						bson.EC.Int64("metadata.creationTimestamp", -1),
-					),
-					Options: bson.NewDocument(
-						bson.EC.Boolean("background", true),
-						bson.EC.Boolean("unique", false),
-						bson.EC.Boolean("sparse", true),
-						bson.EC.String("name", "query_time"),
-					),
+				{
+					Keys:    bson.D{{Key: "metadata.creationTimestamp", Value: -1}},
+					Options: options.Index().SetBackground(true).SetSparse(true).SetName("query_time"),
 				},
-			)
+			})
+
+			if err = p.retention.ensureIndex(p.rootCtx, p.logContext, p.mongoDatabase, colname); err != nil {
+				return
+			}
 
 			go p.dealEventChan()
 
@@ -202,187 +236,195 @@ func (p *mongodbPipe) Start() (err error) {
 	return err
 }
 
-func (p *mongodbPipe) Stop() {
-	logrus.WithFields(p.logContext).Debugln("stopping")
+func (p *mongodbPipe) Stop(ctx context.Context) int {
+	p.stopOnce.Do(func() {
+		logrus.WithFields(p.logContext).Debugln("stopping")
 
-	<-p.flushEventChan()
-	p.mongoClient.Disconnect(p.rootCtx)
-	p.mongoDatabase = nil
-	p.mongoCollection = nil
-	p.rootCancelFunc()
+		// a pipe which has never started can't start anymore, and has nothing to consume
+		p.Do(func() {
+			close(p.eventChanDone)
+		})
 
-	logrus.WithFields(p.logContext).Debugln("stopped")
-}
+		// refuse the new events and close the queue, the pending sending
+		// can finish as the queue is still consuming
+		p.Lock()
+		p.stopping = true
+		close(p.eventChan)
+		p.Unlock()
 
-func (p *mongodbPipe) OnAdd(event *apiCoreV1.Event) error {
-	p.RLock()
-	defer p.RUnlock()
+		select {
+		case <-p.eventChanDone:
+		case <-ctx.Done():
+			// drop the remaining events and abort the in-flight operation
+			atomic.StoreInt32(&p.eventChanDrop, 1)
+			p.rootCancelFunc()
+			<-p.eventChanDone
+		}
 
-	involvedObject := event.InvolvedObject
-	kind := involvedObject.Kind
-	namespace := involvedObject.Namespace
-	name := involvedObject.Name
+		if p.mongoClient != nil {
+			p.mongoClient.Disconnect(context.Background())
+		}
+		p.mongoDatabase = nil
+		p.mongoCollection = nil
+		p.rootCancelFunc()
 
-	var bufferEventBson *bson.Document
-	switch kind {
-	case "Pod":
-		bufferEventBson = eventToBson(event)
+		logrus.WithFields(p.logContext).Debugf("stopped, dropped %d events", atomic.LoadInt64(&p.dropped))
+	})
 
-		// scrape Pod info
-		podInfo, err := p.kclient.CoreV1().Pods(namespace).Get(name, apisMetaV1.GetOptions{})
-		if err != nil {
-			return err
-		}
-		podInfoJson, err := json.Marshal(podInfo)
-		if err != nil {
-			return err
-		}
+	return int(atomic.LoadInt64(&p.dropped))
+}
 
-		if p.enableJsonAttach {
-			bufferEventBson.Append(
-				bson.EC.String(dataAttachJsonKey, *(*string)(unsafe.Pointer(&podInfoJson))),
-			)
-		} else {
-			podInfoBson, err := bson.ParseExtJSONObject(*(*string)(unsafe.Pointer(&podInfoJson)))
-			if err != nil {
-				return err
-			}
+func (p *mongodbPipe) OnAdd(event *apiCoreV1.Event) error {
+	p.RLock()
+	defer p.RUnlock()
 
-			bufferEventBson.Append(
-				bson.EC.SubDocument(dataAttachDocKey, podInfoBson),
-			)
-		}
-	case "Node":
-		bufferEventBson = eventToBson(event)
+	kind := event.InvolvedObject.Kind
+	if !p.kinds.isIncluded(kind) {
+		logrus.WithFields(p.logContext).Debugf("ignoring the addition operation for %s", kind)
+		return nil
+	}
 
-		// scrape Node info
-		nodeInfo, err := p.kclient.CoreV1().Nodes().Get(name, apisMetaV1.GetOptions{})
-		if err != nil {
-			return err
-		}
-		nodeInfoJson, err := json.Marshal(nodeInfo)
-		if err != nil {
-			return err
-		}
+	unit := eventChanUnit{
+		event:       event,
+		eventHandle: sinks.OnAdd,
+	}
 
+	// scrape involved object info, which is nil if the object has gone or isn't attached,
+	// the event is still stored without the attachment if the scraping fails
+	infoJson, err := p.attacher.scrape(&event.InvolvedObject)
+	if err != nil {
+		logrus.WithFields(p.logContext).WithError(err).Warnf("failed to attach the involved object of event %s", event.UID)
+	} else if infoJson != nil {
 		if p.enableJsonAttach {
-			bufferEventBson.Append(
-				bson.EC.String(dataAttachJsonKey, *(*string)(unsafe.Pointer(&nodeInfoJson))),
-			)
-		} else {
-			nodeInfoBson, err := bson.ParseExtJSONObject(*(*string)(unsafe.Pointer(&nodeInfoJson)))
-			if err != nil {
-				return err
-			}
-
-			bufferEventBson.Append(
-				bson.EC.SubDocument(dataAttachDocKey, nodeInfoBson),
-			)
+			unit.attachJson = string(infoJson)
+		} else if err := bson.UnmarshalExtJSON(infoJson, false, &unit.attachDoc); err != nil {
+			unit.attachDoc = nil
+			logrus.WithFields(p.logContext).WithError(err).Warnf("failed to attach the involved object of event %s", event.UID)
 		}
-	default:
-		logrus.WithFields(p.logContext).Debugf("ignoring the addition operation for %s", kind)
 	}
 
-	if bufferEventBson != nil {
-		p.eventChan <- eventChanUnit{
-			bufferEventBson,
-			sinks.OnAdd,
-		}
+	if p.enableLifecycle {
+		unit.history = newMongodbHistory(event)
 	}
 
-	return nil
+	return p.enqueue(unit)
 }
 
-func (p *mongodbPipe) OnUpdate(_ *apiCoreV1.Event, event *apiCoreV1.Event) error {
+func (p *mongodbPipe) OnUpdate(oldEvent *apiCoreV1.Event, event *apiCoreV1.Event) error {
 	p.RLock()
 	defer p.RUnlock()
 
-	involvedObject := event.InvolvedObject
-	kind := involvedObject.Kind
-
-	var bufferEventBson *bson.Document
-	switch kind {
-	case "Pod", "Node":
-		bufferEventBson = eventToBson(event)
-	default:
+	kind := event.InvolvedObject.Kind
+	if !p.kinds.isIncluded(kind) {
 		logrus.WithFields(p.logContext).Debugf("ignoring the updating operation for %s", kind)
+		return nil
 	}
 
-	if bufferEventBson != nil {
-		p.eventChan <- eventChanUnit{
-			bufferEventBson,
-			sinks.OnUpdate,
-		}
+	unit := eventChanUnit{
+		event:       event,
+		eventHandle: sinks.OnUpdate,
 	}
 
-	return nil
+	if p.enableLifecycle && (oldEvent == nil || oldEvent.Count != event.Count || !oldEvent.LastTimestamp.Equal(&event.LastTimestamp)) {
+		unit.history = newMongodbHistory(event)
+	}
 
+	return p.enqueue(unit)
 }
 
 func (p *mongodbPipe) OnDelete(event *apiCoreV1.Event) error {
-	logrus.WithFields(p.logContext).Debugln("ignoring the deletion operation")
-	return nil
+	return p.markDeleted(event, sinks.OnDelete)
+}
+
+// OnExpire implements the sinks.ExpirationPipe.
+func (p *mongodbPipe) OnExpire(event *apiCoreV1.Event) error {
+	return p.markDeleted(event, sinks.OnExpire)
+}
+
+func (p *mongodbPipe) markDeleted(event *apiCoreV1.Event, handle sinks.Handle) error {
+	p.RLock()
+	defer p.RUnlock()
+
+	if !p.enableLifecycle {
+		logrus.WithFields(p.logContext).Debugln("ignoring the deletion operation")
+		return nil
+	}
+
+	kind := event.InvolvedObject.Kind
+	if !p.kinds.isIncluded(kind) {
+		logrus.WithFields(p.logContext).Debugf("ignoring the deletion operation for %s", kind)
+		return nil
+	}
+
+	return p.enqueue(eventChanUnit{
+		event:       event,
+		eventHandle: handle,
+	})
 }
 
 func (p *mongodbPipe) OnList(eventList *apiCoreV1.EventList) error {
 	p.RLock()
 	defer p.RUnlock()
 
-	for _, event := range eventList.Items {
-		involvedObject := event.InvolvedObject
-		kind := involvedObject.Kind
+	for i := range eventList.Items {
+		event := &eventList.Items[i]
 
-		var bufferEventBson *bson.Document
-		switch kind {
-		case "Pod", "Node":
-			bufferEventBson = eventToBson(&event)
-		default:
+		kind := event.InvolvedObject.Kind
+		if !p.kinds.isIncluded(kind) {
 			logrus.WithFields(p.logContext).Debugf("ignoring the listing operation for %s", kind)
+			continue
 		}
 
-		if bufferEventBson != nil {
-			p.eventChan <- eventChanUnit{
-				bufferEventBson,
-				sinks.OnList,
-			}
+		unit := eventChanUnit{
+			event:       event,
+			eventHandle: sinks.OnList,
+		}
+		if p.enableLifecycle {
+			unit.history = newMongodbHistory(event)
+		}
+
+		if err := p.enqueue(unit); err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
 
-func (p *mongodbPipe) flushEventChan() <-chan struct{} {
-	ch := make(chan struct{})
-	p.eventChanStop <- ch
-	return ch
+// enqueue must be called with the read lock held.
+func (p *mongodbPipe) enqueue(unit eventChanUnit) error {
+	if p.stopping {
+		atomic.AddInt64(&p.dropped, 1)
+		return errors.New("pipe is stopping")
+	}
+
+	p.eventChan <- unit
+	return nil
 }
 
 func (p *mongodbPipe) dealEventChan() {
-loop:
-	for {
-		select {
-		case unit := <-p.eventChan:
-			p.dealingEvent(&unit)
-
-		case done := <-p.eventChanStop:
-			// get the lock and prevent new event
-			p.Lock()
-
-			// deal all caching event
-			for unit := range p.eventChan {
-				p.dealingEvent(&unit)
-			}
+	defer close(p.eventChanDone)
 
-			close(p.eventChan)
-			close(done)
-			p.Unlock()
+	// a causally consistent session reads its own writes,
+	// even if the reading prefers the secondaries
+	session, err := p.mongoClient.StartSession(options.Session().SetCausalConsistency(true))
+	if err != nil {
+		logrus.WithFields(p.logContext).WithError(err).Warnln("failed to start session, dealing events without session")
+	} else {
+		defer session.EndSession(context.Background())
+	}
 
-			break loop
+	for unit := range p.eventChan {
+		if atomic.LoadInt32(&p.eventChanDrop) == 1 {
+			atomic.AddInt64(&p.dropped, 1)
+			continue
 		}
+
+		p.dealingEvent(session, &unit)
 	}
 }
 
-func (p *mongodbPipe) dealingEvent(unit *eventChanUnit) {
+func (p *mongodbPipe) dealingEvent(session mongo.Session, unit *eventChanUnit) {
 	defer func() {
 		if r := recover(); r != nil {
 			if err, ok := r.(error); ok {
@@ -393,108 +435,159 @@ func (p *mongodbPipe) dealingEvent(unit *eventChanUnit) {
 		}
 	}()
 
-	if unit == nil {
+	if unit == nil || unit.event == nil {
 		return
 	}
 
-	eventBson := unit.eventBson
-	metadataUidElement, err := eventBson.LookupElementErr("metadata", "uid")
-	if err != nil {
+	metadataUid := string(unit.event.UID)
+	if len(metadataUid) == 0 {
 		panic(errors.New(`the "metadata.uid" is required`))
 	}
-	metadataUid := metadataUidElement.Value().StringValue()
 
+	ctx, cancelFunc := context.WithTimeout(p.rootCtx, p.operationTimeout)
+	defer cancelFunc()
+
+	var err error
+	if session != nil {
+		err = mongo.WithSession(ctx, session, func(sc mongo.SessionContext) error {
+			return p.dealEvent(sc, unit, metadataUid)
+		})
+	} else {
+		err = p.dealEvent(ctx, unit, metadataUid)
+	}
+	if err != nil {
+		panic(err)
+	}
+}
+
+func (p *mongodbPipe) dealEvent(ctx context.Context, unit *eventChanUnit, metadataUid string) error {
 	switch unit.eventHandle {
 	case sinks.OnList:
-		ret := p.mongoCollection.FindOne(
-			p.rootCtx,
-			bson.NewDocument(
-				bson.EC.String("metadata.uid", metadataUid),
-			),
-			option.OptProjection{
-				Projection: bson.NewDocument(
-					bson.EC.Boolean(dataOpenIdKey, false),
-					bson.EC.Boolean(dataAttachJsonKey, false),
-					bson.EC.Boolean(dataAttachDocKey, false),
-				),
+		// skip the unchanged events on relisting
+		err := p.mongoCollection.FindOne(
+			ctx,
+			bson.M{
+				"metadata.uid":             metadataUid,
+				"metadata.resourceVersion": unit.event.ResourceVersion,
 			},
-		)
-		inDoc := bson.NewDocument()
-		if err := ret.Decode(inDoc); err != nil {
-			if err != mongo.ErrNoDocuments {
-				panic(errors.Annotatef(err, "can't find \n%s", eventBson.ToExtJSON(true)))
-			} else {
-				_, err := p.mongoCollection.InsertOne(
-					p.rootCtx,
-					eventBson,
-				)
-				if err != nil {
-					panic(errors.Annotatef(err, "can't insert \n%s", eventBson.ToExtJSON(true)))
-				} else {
-					logrus.WithFields(p.logContext).Debugln("success add event:", metadataUid)
-				}
-			}
-		} else {
-			if !inDoc.Equal(eventBson) {
-				_, err := p.mongoCollection.UpdateOne(
-					p.rootCtx,
-					bson.NewDocument(
-						bson.EC.String("metadata.uid", metadataUid),
-					),
-					eventBson,
-				)
-				if err != nil {
-					panic(errors.Annotatef(err, "can't update \n%s", eventBson.ToExtJSON(true)))
-				} else {
-					logrus.WithFields(p.logContext).Debugln("success update event:", metadataUid)
-				}
-			}
+			options.FindOne().SetProjection(bson.M{dataOpenIdKey: 1}),
+		).Err()
+		if err == nil {
+			return nil
+		} else if err != mongo.ErrNoDocuments {
+			return errors.Annotatef(err, "can't find event %s", metadataUid)
 		}
-	case sinks.OnAdd:
-		_, err := p.mongoCollection.InsertOne(
-			p.rootCtx,
-			eventBson,
-		)
-		if err != nil {
-			panic(errors.Annotatef(err, "can't insert \n%s", eventBson.ToExtJSON(true)))
-		} else {
-			logrus.WithFields(p.logContext).Debugln("success add event:", metadataUid)
+
+		return p.upsert(ctx, unit, metadataUid)
+	case sinks.OnAdd, sinks.OnUpdate:
+		return p.upsert(ctx, unit, metadataUid)
+	case sinks.OnDelete, sinks.OnExpire:
+		cause := deletionCauseDeleted
+		if unit.eventHandle == sinks.OnExpire {
+			cause = deletionCauseExpired
 		}
-	case sinks.OnUpdate:
-		ret := p.mongoCollection.FindOneAndUpdate(
-			p.rootCtx,
-			bson.NewDocument(
-				bson.EC.String("metadata.uid", metadataUid),
-			),
-			eventBson,
-			option.OptProjection{
-				Projection: bson.NewDocument(
-					bson.EC.Boolean("_id", true),
-				),
+
+		// the first deletion wins, e.g. an expired event may be deleted by the API later
+		if _, err := p.mongoCollection.UpdateOne(
+			ctx,
+			bson.M{
+				"metadata.uid":   metadataUid,
+				dataDeletedAtKey: bson.M{"$exists": false},
 			},
-			option.OptMaxTime(10*time.Second),
-		)
-		if err := ret.Decode(nil); err != nil {
-			panic(errors.Annotatef(err, "can't update \n%s", eventBson.ToExtJSON(true)))
-		} else {
-			logrus.WithFields(p.logContext).Debugln("success update event:", metadataUid)
+			bson.M{
+				"$set": bson.M{
+					dataDeletedAtKey:     time.Now(),
+					dataDeletionCauseKey: cause,
+				},
+			},
+		); err != nil {
+			return errors.Annotatef(err, "can't mark deletion of %s", metadataUid)
 		}
+		logrus.WithFields(p.logContext).Debugf("success mark event %s: %s", cause, metadataUid)
 	}
+
+	return nil
 }
 
-func NewMongoDB(khost string, kclient kubernetes.Interface) *mongodbPipe {
+// upsert sets the mutable fields of the event, and only sets the attachment on inserting,
+// so that the relisting, restarting or reordering never fails or loses the attachment.
+// The inserted document is identified by the event uid, which keeps the document key of
+// the change streams stable.
+func (p *mongodbPipe) upsert(ctx context.Context, unit *eventChanUnit, metadataUid string) error {
+	if p.retention.isTimeseries() {
+		// a time-series collection records each observation of the event
+		if _, err := p.mongoCollection.InsertOne(ctx, &mongodbObservation{
+			Event:      *unit.event,
+			RetainedAt: p.retention.retainedAt(unit.event),
+			AttachJson: unit.attachJson,
+			AttachDoc:  unit.attachDoc,
+		}); err != nil {
+			return errors.Annotatef(err, "can't insert event %s", metadataUid)
+		}
+		logrus.WithFields(p.logContext).Debugln("success add event observation:", metadataUid)
+		return nil
+	}
+
+	setOnInsert := bson.M{dataOpenIdKey: metadataUid}
+	if len(unit.attachJson) != 0 {
+		setOnInsert[dataAttachJsonKey] = unit.attachJson
+	}
+	if unit.attachDoc != nil {
+		setOnInsert[dataAttachDocKey] = unit.attachDoc
+	}
+
+	update := bson.M{
+		"$set": &mongodbDocument{
+			Event:      *unit.event,
+			RetainedAt: p.retention.retainedAt(unit.event),
+		},
+		"$setOnInsert": setOnInsert,
+	}
+	if unit.history != nil {
+		update["$push"] = bson.M{dataHistoryKey: unit.history}
+	}
+
+	ret, err := p.mongoCollection.UpdateOne(
+		ctx,
+		bson.M{"metadata.uid": metadataUid},
+		update,
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return errors.Annotatef(err, "can't upsert event %s", metadataUid)
+	}
+
+	if ret.UpsertedID != nil {
+		logrus.WithFields(p.logContext).Debugln("success add event:", metadataUid)
+	} else {
+		logrus.WithFields(p.logContext).Debugln("success update event:", metadataUid)
+	}
+	return nil
+}
+
+func NewMongoDB(name, cluster, khost string, kclient kubernetes.Interface, dclient dynamic.Interface, options Options) *mongodbPipe {
 	ctx, cancelFunc := context.WithCancel(context.Background())
+	logContext := logger.CreateLogContext("PIPE<"+name+">", cluster)
 
 	return &mongodbPipe{
-		logContext: logger.CreateLogContext("PIPE<mongodb>", khost),
+		logContext: logContext,
+		khost:      khost,
+		options:    options,
 
 		rootCtx:        ctx,
 		rootCancelFunc: cancelFunc,
 		eventChan:      make(chan eventChanUnit, 1<<20),
-		eventChanStop:  make(chan chan struct{}),
+		eventChanDone:  make(chan struct{}),
+
+		attacher: newMongodbAttacher(logContext, kclient, dclient),
+	}
+}
 
-		kclient: kclient,
+func mongodbDatabaseName(options Options) string {
+	if dbname := options.Get(MongodbDatabaseNameEnvKey); len(dbname) != 0 {
+		return dbname
 	}
+	return "kubernetes_events"
 }
 
 func hashing(bytes []byte) string {
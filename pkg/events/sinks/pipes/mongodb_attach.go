@@ -0,0 +1,175 @@
+package pipes
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/sirupsen/logrus"
+	apiCoreV1 "k8s.io/api/core/v1"
+	apiErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	apisMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery/cached"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/restmapper"
+)
+
+const (
+	MongodbIncludedKindsEnvKey = "PIPE_MONGODB_INCLUDED_KINDS"
+	MongodbExcludedKindsEnvKey = "PIPE_MONGODB_EXCLUDED_KINDS"
+	MongodbEnableAttachEnvKey  = "PIPE_MONGODB_ENABLE_ATTACH"
+
+	// mongodbMapperResetPeriod limits how often the unknown kinds rediscover the API,
+	// so that a flood of the events of a missing kind never floods the discovery
+	mongodbMapperResetPeriod = 1 * time.Minute
+)
+
+// mongodbUnattachedKinds are never attached, as their objects carry the credentials.
+var mongodbUnattachedKinds = map[schema.GroupKind]struct{}{
+	{Kind: "Secret"}: {},
+}
+
+// mongodbKinds selects the events by the kind of their involved objects,
+// a blank included list means all kinds.
+type mongodbKinds struct {
+	included map[string]struct{}
+	excluded map[string]struct{}
+}
+
+func (k *mongodbKinds) isIncluded(kind string) bool {
+	if _, ok := k.excluded[kind]; ok {
+		return false
+	}
+
+	if len(k.included) == 0 {
+		return true
+	}
+	_, ok := k.included[kind]
+	return ok
+}
+
+func parseMongodbKinds(options Options) *mongodbKinds {
+	return &mongodbKinds{
+		included: splitKinds(options.Get(MongodbIncludedKindsEnvKey)),
+		excluded: splitKinds(options.Get(MongodbExcludedKindsEnvKey)),
+	}
+}
+
+func splitKinds(value string) map[string]struct{} {
+	ret := make(map[string]struct{})
+	for _, kind := range strings.Split(value, ",") {
+		if kind = strings.TrimSpace(kind); len(kind) != 0 {
+			ret[kind] = struct{}{}
+		}
+	}
+
+	return ret
+}
+
+// mongodbAttacher scrapes the involved object of an event, Pods and Nodes are got
+// by the typed client, the others are only got by the dynamic client if enabled.
+type mongodbAttacher struct {
+	logContext logrus.Fields
+
+	kclient       kubernetes.Interface
+	dclient       dynamic.Interface
+	enableDynamic bool
+	mapper        *restmapper.DeferredDiscoveryRESTMapper
+	resetAt       time.Time
+	resetMu       sync.Mutex
+}
+
+// scrape returns the json form of the involved object, or nil if it has gone.
+func (a *mongodbAttacher) scrape(involvedObject *apiCoreV1.ObjectReference) ([]byte, error) {
+	var (
+		obj interface{}
+		err error
+	)
+
+	switch involvedObject.Kind {
+	case "Pod":
+		obj, err = a.kclient.CoreV1().Pods(involvedObject.Namespace).Get(involvedObject.Name, apisMetaV1.GetOptions{})
+	case "Node":
+		obj, err = a.kclient.CoreV1().Nodes().Get(involvedObject.Name, apisMetaV1.GetOptions{})
+	default:
+		if a.enableDynamic {
+			obj, err = a.scrapeDynamic(involvedObject)
+		}
+	}
+
+	if err != nil {
+		if apiErrors.IsNotFound(err) {
+			logrus.WithFields(a.logContext).Debugf("ignoring the attachment of gone %s %s/%s", involvedObject.Kind, involvedObject.Namespace, involvedObject.Name)
+			return nil, nil
+		}
+		return nil, err
+	}
+	if obj == nil {
+		return nil, nil
+	}
+
+	return json.Marshal(obj)
+}
+
+func (a *mongodbAttacher) scrapeDynamic(involvedObject *apiCoreV1.ObjectReference) (interface{}, error) {
+	if a.dclient == nil {
+		return nil, nil
+	}
+
+	gv, err := schema.ParseGroupVersion(involvedObject.APIVersion)
+	if err != nil {
+		return nil, errors.Annotatef(err, "can't parse apiVersion %s", involvedObject.APIVersion)
+	}
+
+	gk := gv.WithKind(involvedObject.Kind).GroupKind()
+	if _, ok := mongodbUnattachedKinds[gk]; ok {
+		return nil, nil
+	}
+
+	mapping, err := a.mapper.RESTMapping(gk, gv.Version)
+	if err != nil {
+		// the kind may be served after the discovery was cached, e.g. a new CRD
+		if !a.tryReset() {
+			logrus.WithFields(a.logContext).WithError(err).Debugf("ignoring the attachment of unknown %s", involvedObject.Kind)
+			return nil, nil
+		}
+		if mapping, err = a.mapper.RESTMapping(gk, gv.Version); err != nil {
+			logrus.WithFields(a.logContext).WithError(err).Debugf("ignoring the attachment of unknown %s", involvedObject.Kind)
+			return nil, nil
+		}
+	}
+
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		return a.dclient.Resource(mapping.Resource).Namespace(involvedObject.Namespace).Get(involvedObject.Name, apisMetaV1.GetOptions{})
+	}
+	return a.dclient.Resource(mapping.Resource).Get(involvedObject.Name, apisMetaV1.GetOptions{})
+}
+
+// tryReset drops the cached discovery at most once a period, and returns false if
+// it has been dropped recently.
+func (a *mongodbAttacher) tryReset() bool {
+	a.resetMu.Lock()
+	defer a.resetMu.Unlock()
+
+	if time.Since(a.resetAt) < mongodbMapperResetPeriod {
+		return false
+	}
+	a.resetAt = time.Now()
+	a.mapper.Reset()
+	return true
+}
+
+func newMongodbAttacher(logContext logrus.Fields, kclient kubernetes.Interface, dclient dynamic.Interface) *mongodbAttacher {
+	return &mongodbAttacher{
+		logContext: logContext,
+
+		kclient: kclient,
+		dclient: dclient,
+		mapper:  restmapper.NewDeferredDiscoveryRESTMapper(cached.NewMemCacheClient(kclient.Discovery())),
+	}
+}
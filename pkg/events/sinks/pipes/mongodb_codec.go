@@ -0,0 +1,115 @@
+package pipes
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/juju/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/bson/bsonrw"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	apiCoreV1 "k8s.io/api/core/v1"
+	apisMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// mongodbRegistry marshals the Kubernetes objects by their json tags, so that the stored
+// documents keep the same field names as the API, and the API times are stored as dates.
+var mongodbRegistry = newMongodbRegistry()
+
+// mongodbDocument is the event set into a standard or capped collection.
+type mongodbDocument struct {
+	apiCoreV1.Event `bson:",inline"`
+
+	RetainedAt time.Time `bson:"_retainedAt"`
+}
+
+// mongodbObservation is the document inserted into a time-series collection.
+type mongodbObservation struct {
+	apiCoreV1.Event `bson:",inline"`
+
+	RetainedAt time.Time `bson:"_retainedAt"`
+	AttachJson string    `bson:"_attachJson,omitempty"`
+	AttachDoc  bson.D    `bson:"_attachDoc,omitempty"`
+}
+
+// mongodbHistory records the changing part of the event at the moment.
+type mongodbHistory struct {
+	Count         int32           `bson:"count"`
+	LastTimestamp apisMetaV1.Time `bson:"lastTimestamp"`
+	RecordedAt    time.Time       `bson:"recordedAt"`
+}
+
+func newMongodbHistory(event *apiCoreV1.Event) *mongodbHistory {
+	return &mongodbHistory{
+		Count:         event.Count,
+		LastTimestamp: event.LastTimestamp,
+		RecordedAt:    time.Now(),
+	}
+}
+
+func newMongodbRegistry() *bsoncodec.Registry {
+	rb := bson.NewRegistryBuilder()
+
+	structCodec, err := bsoncodec.NewStructCodec(bsoncodec.JSONFallbackStructTagParser)
+	if err != nil {
+		panic(err)
+	}
+	rb.RegisterDefaultEncoder(reflect.Struct, structCodec)
+	rb.RegisterDefaultDecoder(reflect.Struct, structCodec)
+
+	rb.RegisterTypeEncoder(reflect.TypeOf(apisMetaV1.Time{}), bsoncodec.ValueEncoderFunc(encodeMetaTime))
+	rb.RegisterTypeEncoder(reflect.TypeOf(apisMetaV1.MicroTime{}), bsoncodec.ValueEncoderFunc(encodeMetaTime))
+	rb.RegisterTypeDecoder(reflect.TypeOf(apisMetaV1.Time{}), bsoncodec.ValueDecoderFunc(decodeMetaTime))
+	rb.RegisterTypeDecoder(reflect.TypeOf(apisMetaV1.MicroTime{}), bsoncodec.ValueDecoderFunc(decodeMetaTime))
+
+	return rb.Build()
+}
+
+// encodeMetaTime writes the API times as dates rather than the embedding structs,
+// the zero time is written as null like the API does, the TTL indexes and the
+// time-series collections use the retention field instead.
+func encodeMetaTime(_ bsoncodec.EncodeContext, vw bsonrw.ValueWriter, val reflect.Value) error {
+	var t time.Time
+	switch v := val.Interface().(type) {
+	case apisMetaV1.Time:
+		t = v.Time
+	case apisMetaV1.MicroTime:
+		t = v.Time
+	}
+
+	if t.IsZero() {
+		return vw.WriteNull()
+	}
+
+	return vw.WriteDateTime(t.Unix()*1e3 + int64(t.Nanosecond())/1e6)
+}
+
+// decodeMetaTime reads the dates written by encodeMetaTime back to the API times,
+// so that the stored events can be replayed.
+func decodeMetaTime(_ bsoncodec.DecodeContext, vr bsonrw.ValueReader, val reflect.Value) error {
+	var t time.Time
+	switch vr.Type() {
+	case bsontype.DateTime:
+		ms, err := vr.ReadDateTime()
+		if err != nil {
+			return err
+		}
+		t = time.Unix(ms/1e3, ms%1e3*1e6).UTC()
+	case bsontype.Null:
+		if err := vr.ReadNull(); err != nil {
+			return err
+		}
+	default:
+		return errors.Errorf("can't decode %s into time", vr.Type())
+	}
+
+	switch val.Interface().(type) {
+	case apisMetaV1.Time:
+		val.Set(reflect.ValueOf(apisMetaV1.NewTime(t)))
+	case apisMetaV1.MicroTime:
+		val.Set(reflect.ValueOf(apisMetaV1.NewMicroTime(t)))
+	}
+
+	return nil
+}
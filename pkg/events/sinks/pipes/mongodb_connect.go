@@ -0,0 +1,137 @@
+package pipes
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+const (
+	MongodbUsernameEnvKey               = "PIPE_MONGODB_USERNAME"
+	MongodbPasswordEnvKey               = "PIPE_MONGODB_PASSWORD"
+	MongodbAuthSourceEnvKey             = "PIPE_MONGODB_AUTH_SOURCE"
+	MongodbAuthMechanismEnvKey          = "PIPE_MONGODB_AUTH_MECHANISM"
+	MongodbTLSCAFileEnvKey              = "PIPE_MONGODB_TLS_CA_FILE"
+	MongodbTLSCertKeyFileEnvKey         = "PIPE_MONGODB_TLS_CERT_KEY_FILE"
+	MongodbTLSInsecureSkipVerifyEnvKey  = "PIPE_MONGODB_TLS_INSECURE_SKIP_VERIFY"
+	MongodbWriteConcernEnvKey           = "PIPE_MONGODB_WRITE_CONCERN"
+	MongodbWriteTimeoutEnvKey           = "PIPE_MONGODB_WRITE_TIMEOUT"
+	MongodbJournalEnvKey                = "PIPE_MONGODB_JOURNAL"
+	MongodbReadPreferenceEnvKey         = "PIPE_MONGODB_READ_PREFERENCE"
+	MongodbMaxPoolSizeEnvKey            = "PIPE_MONGODB_MAX_POOL_SIZE"
+	MongodbConnectTimeoutEnvKey         = "PIPE_MONGODB_CONNECT_TIMEOUT"
+	MongodbServerSelectionTimeoutEnvKey = "PIPE_MONGODB_SERVER_SELECTION_TIMEOUT"
+	MongodbOperationTimeoutEnvKey       = "PIPE_MONGODB_OPERATION_TIMEOUT"
+
+	mongodbDefaultOperationTimeout = 10 * time.Second
+)
+
+// mongodbConnectURI merges the explicit options into the connection URI, an explicit
+// option overrides the same one of the URI. The URI, the username and the password
+// can be read from files, e.g. the mounted Secrets, by the options with "_FILE" suffix.
+func mongodbConnectURI(options Options) (string, error) {
+	uri, err := options.GetWithFile(MongodbConnectURIEnvKey)
+	if err != nil {
+		return "", err
+	}
+	if len(uri) == 0 {
+		return "", errors.Errorf(`"%s" option is required`, MongodbConnectURIEnvKey)
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", errors.Annotatef(err, `can't parse "%s" option`, MongodbConnectURIEnvKey)
+	}
+
+	username, err := options.GetWithFile(MongodbUsernameEnvKey)
+	if err != nil {
+		return "", err
+	}
+	password, err := options.GetWithFile(MongodbPasswordEnvKey)
+	if err != nil {
+		return "", err
+	}
+	if len(username) != 0 {
+		if len(password) != 0 {
+			u.User = url.UserPassword(username, password)
+		} else {
+			u.User = url.User(username)
+		}
+	}
+
+	query := u.Query()
+	setQuery := func(name, value string) {
+		if len(value) != 0 {
+			query.Set(name, value)
+		}
+	}
+	setQueryMillis := func(name, key string) error {
+		value := options.Get(key)
+		if len(value) == 0 {
+			return nil
+		}
+
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return errors.Annotatef(err, `can't parse "%s" option`, key)
+		}
+		query.Set(name, strconv.FormatInt(int64(d/time.Millisecond), 10))
+		return nil
+	}
+
+	setQuery("authSource", options.Get(MongodbAuthSourceEnvKey))
+	setQuery("authMechanism", options.Get(MongodbAuthMechanismEnvKey))
+
+	caFile := options.Get(MongodbTLSCAFileEnvKey)
+	certKeyFile := options.Get(MongodbTLSCertKeyFileEnvKey)
+	insecureSkipVerify := strings.ToLower(options.Get(MongodbTLSInsecureSkipVerifyEnvKey)) == "true"
+	if len(caFile) != 0 || len(certKeyFile) != 0 || insecureSkipVerify {
+		query.Set("tls", "true")
+		setQuery("tlsCAFile", caFile)
+		setQuery("tlsCertificateKeyFile", certKeyFile)
+		if insecureSkipVerify {
+			query.Set("tlsInsecure", "true")
+		}
+	}
+
+	setQuery("w", options.Get(MongodbWriteConcernEnvKey))
+	if err := setQueryMillis("wTimeoutMS", MongodbWriteTimeoutEnvKey); err != nil {
+		return "", err
+	}
+	setQuery("journal", strings.ToLower(options.Get(MongodbJournalEnvKey)))
+	setQuery("readPreference", options.Get(MongodbReadPreferenceEnvKey))
+
+	if maxPoolSize := options.Get(MongodbMaxPoolSizeEnvKey); len(maxPoolSize) != 0 {
+		if _, err := strconv.ParseUint(maxPoolSize, 10, 16); err != nil {
+			return "", errors.Annotatef(err, `can't parse "%s" option`, MongodbMaxPoolSizeEnvKey)
+		}
+		query.Set("maxPoolSize", maxPoolSize)
+	}
+
+	if err := setQueryMillis("connectTimeoutMS", MongodbConnectTimeoutEnvKey); err != nil {
+		return "", err
+	}
+	if err := setQueryMillis("serverSelectionTimeoutMS", MongodbServerSelectionTimeoutEnvKey); err != nil {
+		return "", err
+	}
+
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// mongodbOperationTimeout returns the deadline of each operation.
+func mongodbOperationTimeout(options Options) (time.Duration, error) {
+	value := options.Get(MongodbOperationTimeoutEnvKey)
+	if len(value) == 0 {
+		return mongodbDefaultOperationTimeout, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, errors.Annotatef(err, `can't parse "%s" option`, MongodbOperationTimeoutEnvKey)
+	}
+	return d, nil
+}
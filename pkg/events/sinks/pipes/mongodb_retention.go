@@ -0,0 +1,367 @@
+package pipes
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/streams"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	apiCoreV1 "k8s.io/api/core/v1"
+)
+
+const (
+	MongodbRetentionEnvKey          = "PIPE_MONGODB_RETENTION"
+	MongodbRetentionFieldEnvKey     = "PIPE_MONGODB_RETENTION_FIELD"
+	MongodbCollectionTypeEnvKey     = "PIPE_MONGODB_COLLECTION_TYPE"
+	MongodbCappedSizeEnvKey         = "PIPE_MONGODB_CAPPED_SIZE"
+	MongodbCappedMaxDocumentsEnvKey = "PIPE_MONGODB_CAPPED_MAX_DOCUMENTS"
+
+	mongodbCollectionStandard   = "standard"
+	mongodbCollectionCapped     = "capped"
+	mongodbCollectionTimeseries = "timeseries"
+
+	mongodbRetentionIndexName = "retention"
+	// mongodbRetentionKey keeps the time of the retention field, which falls back to
+	// the other times of the event if the field is blank, e.g. the lastTimestamp of the
+	// events reported by the events.k8s.io API
+	mongodbRetentionKey      = "_retainedAt"
+	mongodbTimeseriesMetaKey = "involvedObject"
+)
+
+var mongodbRetentionFields = map[string]struct{}{
+	"lastTimestamp":              {},
+	"metadata.creationTimestamp": {},
+}
+
+// mongodbRetention manages how long the events are kept by MongoDB:
+//   - a standard collection expires the events by a TTL index on the retention field;
+//   - a capped collection keeps the latest events within its size;
+//   - a time-series collection (MongoDB 5+) records each observation of the events,
+//     and expires them by the collection itself.
+type mongodbRetention struct {
+	ttl            time.Duration
+	field          string
+	collectionType string
+	cappedSize     int64
+	cappedMax      int64
+}
+
+func (r *mongodbRetention) isTimeseries() bool {
+	return r.collectionType == mongodbCollectionTimeseries
+}
+
+// retainedAt returns the time of the retention field, or the fallback times of the event.
+func (r *mongodbRetention) retainedAt(event *apiCoreV1.Event) time.Time {
+	var t time.Time
+	switch r.field {
+	case "metadata.creationTimestamp":
+		t = event.CreationTimestamp.Time
+		if t.IsZero() {
+			t = streams.LastSeen(event)
+		}
+	default:
+		t = streams.LastSeen(event)
+	}
+
+	if t.IsZero() {
+		return time.Now()
+	}
+	return t
+}
+
+// ensureCollection creates the collection in the required type, or adjusts the existing one.
+func (r *mongodbRetention) ensureCollection(ctx context.Context, logContext logrus.Fields, db *mongo.Database, colname string) error {
+	info, err := mongodbCollectionInfo(ctx, db, colname)
+	if err != nil {
+		return errors.Annotatef(err, "can't get info of %s collection", colname)
+	}
+
+	if info == nil {
+		switch r.collectionType {
+		case mongodbCollectionCapped:
+			cmd := bson.D{
+				{Key: "create", Value: colname},
+				{Key: "capped", Value: true},
+				{Key: "size", Value: r.cappedSize},
+			}
+			if r.cappedMax > 0 {
+				cmd = append(cmd, bson.E{Key: "max", Value: r.cappedMax})
+			}
+			if err := db.RunCommand(ctx, cmd).Err(); err != nil {
+				return errors.Annotatef(err, "can't create capped %s collection", colname)
+			}
+		case mongodbCollectionTimeseries:
+			if err := ensureMongodbVersion(ctx, db, 5); err != nil {
+				return err
+			}
+
+			cmd := bson.D{
+				{Key: "create", Value: colname},
+				{Key: "timeseries", Value: bson.D{
+					{Key: "timeField", Value: mongodbRetentionKey},
+					{Key: "metaField", Value: mongodbTimeseriesMetaKey},
+				}},
+			}
+			if r.ttl > 0 {
+				cmd = append(cmd, bson.E{Key: "expireAfterSeconds", Value: int64(r.ttl / time.Second)})
+			}
+			if err := db.RunCommand(ctx, cmd).Err(); err != nil {
+				return errors.Annotatef(err, "can't create time-series %s collection", colname)
+			}
+		}
+
+		return nil
+	}
+
+	capped := info.Options.Capped
+	timeseries := info.Type == mongodbCollectionTimeseries
+
+	switch r.collectionType {
+	case mongodbCollectionCapped:
+		if timeseries {
+			return errors.Errorf("can't convert time-series %s collection to capped", colname)
+		}
+
+		if !capped {
+			logrus.WithFields(logContext).Infof("converting %s collection to capped", colname)
+			if err := db.RunCommand(ctx, bson.D{
+				{Key: "convertToCapped", Value: colname},
+				{Key: "size", Value: r.cappedSize},
+			}).Err(); err != nil {
+				return errors.Annotatef(err, "can't convert %s collection to capped", colname)
+			}
+		}
+
+		cmd := bson.D{
+			{Key: "collMod", Value: colname},
+			{Key: "cappedSize", Value: r.cappedSize},
+		}
+		if r.cappedMax > 0 {
+			cmd = append(cmd, bson.E{Key: "cappedMax", Value: r.cappedMax})
+		}
+		if err := db.RunCommand(ctx, cmd).Err(); err != nil {
+			// resizing a capped collection requires MongoDB 6+
+			logrus.WithFields(logContext).WithError(err).Warnf("can't resize capped %s collection", colname)
+		}
+	case mongodbCollectionTimeseries:
+		if !timeseries {
+			return errors.Errorf("can't convert existing %s collection to time-series", colname)
+		}
+		if timeField := info.Options.Timeseries.TimeField; timeField != mongodbRetentionKey {
+			return errors.Errorf("can't use time-series %s collection on %s, requires %s", colname, timeField, mongodbRetentionKey)
+		}
+
+		cmd := bson.D{
+			{Key: "collMod", Value: colname},
+		}
+		if r.ttl > 0 {
+			cmd = append(cmd, bson.E{Key: "expireAfterSeconds", Value: int64(r.ttl / time.Second)})
+		} else {
+			cmd = append(cmd, bson.E{Key: "expireAfterSeconds", Value: "off"})
+		}
+		if err := db.RunCommand(ctx, cmd).Err(); err != nil {
+			return errors.Annotatef(err, "can't change the expiration of time-series %s collection", colname)
+		}
+	default:
+		if capped || timeseries {
+			logrus.WithFields(logContext).Warnf("keeping %s collection in its own type, as it can't be converted to standard", colname)
+		}
+	}
+
+	return nil
+}
+
+// ensureIndex creates, changes or drops the TTL index of a standard collection,
+// so that changing the retention takes effect on the existing collection.
+func (r *mongodbRetention) ensureIndex(ctx context.Context, logContext logrus.Fields, db *mongo.Database, colname string) error {
+	if r.collectionType != mongodbCollectionStandard {
+		return nil
+	}
+
+	coll := db.Collection(colname)
+	index, err := mongodbIndex(ctx, coll, mongodbRetentionIndexName)
+	if err != nil {
+		return errors.Annotate(err, "can't list indexes")
+	}
+
+	if index != nil {
+		field := ""
+		if len(index.Key) != 0 {
+			field = index.Key[0].Key
+		}
+
+		expireAfterSeconds := int64(-1)
+		if index.ExpireAfterSeconds != nil {
+			expireAfterSeconds = *index.ExpireAfterSeconds
+		}
+
+		switch {
+		case r.ttl <= 0 || field != mongodbRetentionKey:
+			logrus.WithFields(logContext).Infof("dropping %s index on %s", mongodbRetentionIndexName, field)
+			if _, err := coll.Indexes().DropOne(ctx, mongodbRetentionIndexName); err != nil {
+				return errors.Annotatef(err, "can't drop %s index", mongodbRetentionIndexName)
+			}
+		case expireAfterSeconds != int64(r.ttl/time.Second):
+			logrus.WithFields(logContext).Infof("changing %s index to expire after %s", mongodbRetentionIndexName, r.ttl)
+			if err := db.RunCommand(ctx, bson.D{
+				{Key: "collMod", Value: colname},
+				{Key: "index", Value: bson.D{
+					{Key: "name", Value: mongodbRetentionIndexName},
+					{Key: "expireAfterSeconds", Value: int64(r.ttl / time.Second)},
+				}},
+			}).Err(); err != nil {
+				return errors.Annotatef(err, "can't change %s index", mongodbRetentionIndexName)
+			}
+			return nil
+		default:
+			return nil
+		}
+	}
+
+	if r.ttl <= 0 {
+		return nil
+	}
+
+	if _, err := coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: mongodbRetentionKey, Value: 1}},
+		Options: options.Index().
+			SetBackground(true).
+			SetExpireAfterSeconds(int32(r.ttl / time.Second)).
+			SetName(mongodbRetentionIndexName),
+	}); err != nil {
+		return errors.Annotatef(err, "can't create %s index", mongodbRetentionIndexName)
+	}
+
+	return nil
+}
+
+func parseMongodbRetention(options Options) (*mongodbRetention, error) {
+	r := &mongodbRetention{
+		field:          "lastTimestamp",
+		collectionType: mongodbCollectionStandard,
+	}
+
+	if ttl := options.Get(MongodbRetentionEnvKey); len(ttl) != 0 {
+		d, err := time.ParseDuration(ttl)
+		if err != nil {
+			return nil, errors.Annotatef(err, `can't parse "%s" option`, MongodbRetentionEnvKey)
+		}
+		r.ttl = d
+	}
+
+	if field := options.Get(MongodbRetentionFieldEnvKey); len(field) != 0 {
+		if _, ok := mongodbRetentionFields[field]; !ok {
+			return nil, errors.Errorf(`"%s" option must be lastTimestamp or metadata.creationTimestamp`, MongodbRetentionFieldEnvKey)
+		}
+		r.field = field
+	}
+
+	if collectionType := strings.ToLower(options.Get(MongodbCollectionTypeEnvKey)); len(collectionType) != 0 {
+		switch collectionType {
+		case mongodbCollectionStandard, mongodbCollectionCapped, mongodbCollectionTimeseries:
+			r.collectionType = collectionType
+		default:
+			return nil, errors.Errorf(`"%s" option must be standard, capped or timeseries`, MongodbCollectionTypeEnvKey)
+		}
+	}
+
+	if r.collectionType == mongodbCollectionCapped {
+		if r.ttl > 0 {
+			return nil, errors.Errorf(`"%s" option can't be used with capped collection`, MongodbRetentionEnvKey)
+		}
+
+		size, err := strconv.ParseInt(options.Get(MongodbCappedSizeEnvKey), 10, 64)
+		if err != nil || size <= 0 {
+			return nil, errors.Errorf(`"%s" option is required as a positive bytes number with capped collection`, MongodbCappedSizeEnvKey)
+		}
+		r.cappedSize = size
+
+		if max := options.Get(MongodbCappedMaxDocumentsEnvKey); len(max) != 0 {
+			if r.cappedMax, err = strconv.ParseInt(max, 10, 64); err != nil {
+				return nil, errors.Annotatef(err, `can't parse "%s" option`, MongodbCappedMaxDocumentsEnvKey)
+			}
+		}
+	}
+
+	return r, nil
+}
+
+// mongodbCollectionSpec is the part of the listCollections result in use.
+type mongodbCollectionSpec struct {
+	Type    string `bson:"type"`
+	Options struct {
+		Capped     bool `bson:"capped"`
+		Timeseries struct {
+			TimeField string `bson:"timeField"`
+		} `bson:"timeseries"`
+	} `bson:"options"`
+}
+
+// mongodbIndexSpec is the part of the listIndexes result in use.
+type mongodbIndexSpec struct {
+	Name               string `bson:"name"`
+	Key                bson.D `bson:"key"`
+	ExpireAfterSeconds *int64 `bson:"expireAfterSeconds"`
+}
+
+func mongodbCollectionInfo(ctx context.Context, db *mongo.Database, colname string) (*mongodbCollectionSpec, error) {
+	cursor, err := db.ListCollections(ctx, bson.M{"name": colname})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	if !cursor.Next(ctx) {
+		return nil, cursor.Err()
+	}
+
+	info := &mongodbCollectionSpec{}
+	if err := cursor.Decode(info); err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+func mongodbIndex(ctx context.Context, coll *mongo.Collection, name string) (*mongodbIndexSpec, error) {
+	cursor, err := coll.Indexes().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		index := &mongodbIndexSpec{}
+		if err := cursor.Decode(index); err != nil {
+			return nil, err
+		}
+
+		if index.Name == name {
+			return index, nil
+		}
+	}
+
+	return nil, cursor.Err()
+}
+
+func ensureMongodbVersion(ctx context.Context, db *mongo.Database, major int) error {
+	buildInfo := struct {
+		Version string `bson:"version"`
+	}{}
+	if err := db.RunCommand(ctx, bson.D{{Key: "buildInfo", Value: 1}}).Decode(&buildInfo); err != nil {
+		return errors.Annotate(err, "can't get MongoDB version")
+	}
+	version := buildInfo.Version
+
+	if actual, err := strconv.Atoi(strings.SplitN(version, ".", 2)[0]); err != nil || actual < major {
+		return errors.Errorf("MongoDB %s is not supported, requires %d+", version, major)
+	}
+
+	return nil
+}
@@ -0,0 +1,118 @@
+package pipes
+
+import (
+	"context"
+	"time"
+
+	"github.com/juju/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	apiCoreV1 "k8s.io/api/core/v1"
+)
+
+// mongodbSource reads the events stored by a MongoDB pipe of the same options,
+// the collection is found by the Kubernetes host as the pipe maps it.
+type mongodbSource struct {
+	khost   string
+	options Options
+	since   time.Time
+	until   time.Time
+}
+
+func (s *mongodbSource) Read(ctx context.Context, handle func(event *apiCoreV1.Event) error) error {
+	uri, err := mongodbConnectURI(s.options)
+	if err != nil {
+		return err
+	}
+	filter, err := s.filter()
+	if err != nil {
+		return err
+	}
+
+	client, err := mongo.Connect(ctx, options.Client().
+		ApplyURI(uri).
+		SetRegistry(mongodbRegistry).
+		SetRetryReads(true),
+	)
+	if err != nil {
+		return errors.Annotate(err, "MongoDB fail to create client")
+	}
+	defer client.Disconnect(context.Background())
+
+	dbname := mongodbDatabaseName(s.options)
+	database := client.Database(dbname)
+
+	storageCollectionMap := struct {
+		CollectionName string `bson:"collection_name"`
+	}{}
+	if err := database.Collection("collections_map").FindOne(
+		ctx,
+		bson.M{"kubernetes_host": s.khost},
+	).Decode(&storageCollectionMap); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return errors.NotFoundf("collection of %s in %s database", s.khost, dbname)
+		}
+		return errors.Annotatef(err, "can't find info from %s.collections_map collection", dbname)
+	}
+
+	cursor, err := database.Collection(storageCollectionMap.CollectionName).Find(
+		ctx,
+		filter,
+		options.Find().SetSort(bson.D{{Key: "metadata.creationTimestamp", Value: 1}}),
+	)
+	if err != nil {
+		return errors.Annotatef(err, "can't find events from %s collection", storageCollectionMap.CollectionName)
+	}
+	defer cursor.Close(context.Background())
+
+	for cursor.Next(ctx) {
+		event := &apiCoreV1.Event{}
+		if err := cursor.Decode(event); err != nil {
+			return errors.Annotate(err, "can't decode event")
+		}
+		if err := handle(event); err != nil {
+			return err
+		}
+	}
+
+	return errors.Annotatef(cursor.Err(), "can't iterate %s collection", storageCollectionMap.CollectionName)
+}
+
+// filter narrows the query to the time range by the retained times, which are the last
+// seen times of the events unless the pipe retains them by the creation. The documents
+// stored without the retained times are kept, the exact range is still checked by the reader.
+func (s *mongodbSource) filter() (bson.M, error) {
+	retention, err := parseMongodbRetention(s.options)
+	if err != nil {
+		return nil, err
+	}
+	if (s.since.IsZero() && s.until.IsZero()) || retention.field != "lastTimestamp" {
+		return bson.M{}, nil
+	}
+
+	timeRange := bson.M{}
+	if !s.since.IsZero() {
+		timeRange["$gte"] = s.since
+	}
+	if !s.until.IsZero() {
+		timeRange["$lt"] = s.until
+	}
+	return bson.M{
+		"$or": bson.A{
+			bson.M{mongodbRetentionKey: timeRange},
+			bson.M{mongodbRetentionKey: bson.M{"$exists": false}},
+		},
+	}, nil
+}
+
+// NewMongoDBSource reads the events which a MongoDB pipe of the options has stored
+// for the Kubernetes host, in the order of creation, the zero times leave the range open.
+func NewMongoDBSource(khost string, options Options, since, until time.Time) *mongodbSource {
+	return &mongodbSource{
+		khost:   khost,
+		options: options,
+		since:   since,
+		until:   until,
+	}
+}
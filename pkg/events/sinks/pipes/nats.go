@@ -0,0 +1,331 @@
+package pipes
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/nats-io/nats.go"
+	"github.com/sirupsen/logrus"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/encoding"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/utils/logger"
+	apiCoreV1 "k8s.io/api/core/v1"
+)
+
+const (
+	NatsURLEnvKey             = "PIPE_NATS_URL"
+	NatsSubjectTemplateEnvKey = "PIPE_NATS_SUBJECT_TEMPLATE"
+	NatsEnableJetStreamEnvKey = "PIPE_NATS_ENABLE_JETSTREAM"
+	NatsCredentialsFileEnvKey = "PIPE_NATS_CREDENTIALS_FILE"
+	NatsEncodingEnvKey        = "PIPE_NATS_ENCODING"
+
+	natsDefaultSubjectTemplate = "k8s.events.{cluster}.{namespace}.{kind}"
+	natsOperationHeaderKey     = "Kubernetes-Event-Operation"
+	natsContentTypeHeaderKey   = "Content-Type"
+	natsAttributeHeaderPrefix  = "ce-"
+	natsPublishTimeout         = 10 * time.Second
+	natsBlankToken             = "_"
+	natsQueueSize              = 1 << 16
+)
+
+// natsPipe publishes each change of the events, the messages are queued and published
+// in order by a worker, so that a slow server never blocks the watching. The published
+// messages are flushed whenever the queue is empty, the messages are dropped if the queue
+// is full, or they can't be published or flushed before stopping.
+type natsPipe struct {
+	logContext logrus.Fields
+	cluster    string
+	options    Options
+
+	rootCtx        context.Context
+	rootCancelFunc context.CancelFunc
+	eventChan      chan *nats.Msg
+	eventChanDone  chan struct{}
+	eventChanDrop  int32
+	dropped        int64
+	stopping       bool
+	// unflushed counts the messages published since the last flush
+	unflushed int64
+
+	natsConn        *nats.Conn
+	natsJetStream   nats.JetStreamContext
+	subjectTemplate string
+	encoder         encoding.Encoder
+
+	stopOnce sync.Once
+
+	sync.RWMutex
+	sync.Once
+}
+
+func (p *natsPipe) Start() (err error) {
+	p.Do(func() {
+		logrus.WithFields(p.logContext).Debugln("starting")
+
+		// the queue is never consumed if the starting fails
+		defer func() {
+			if err != nil {
+				close(p.eventChanDone)
+			}
+		}()
+
+		url := p.options.Get(NatsURLEnvKey)
+		if len(url) == 0 {
+			err = errors.Errorf(`"%s" option is required`, NatsURLEnvKey)
+			return
+		}
+
+		p.subjectTemplate = p.options.Get(NatsSubjectTemplateEnvKey)
+		if len(p.subjectTemplate) == 0 {
+			p.subjectTemplate = natsDefaultSubjectTemplate
+		}
+
+		p.encoder, err = newEncoder(p.options, NatsEncodingEnvKey, p.cluster, encoding.JSON)
+		if err != nil {
+			return
+		}
+
+		opts := []nats.Option{
+			nats.Name(fmt.Sprintf("kubernetes-event-exporter(%s)", p.cluster)),
+			nats.MaxReconnects(-1),
+			nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+				logrus.WithFields(p.logContext).WithError(err).Warnln("disconnected")
+			}),
+			nats.ReconnectHandler(func(conn *nats.Conn) {
+				logrus.WithFields(p.logContext).Debugf("reconnected to %s", conn.ConnectedUrl())
+			}),
+		}
+		if credsFile := p.options.Get(NatsCredentialsFileEnvKey); len(credsFile) != 0 {
+			opts = append(opts, nats.UserCredentials(credsFile))
+		}
+
+		p.natsConn, err = nats.Connect(url, opts...)
+		if err != nil {
+			err = errors.Annotate(err, "NATS fail to connect")
+			return
+		}
+
+		if strings.ToLower(p.options.Get(NatsEnableJetStreamEnvKey)) == "true" {
+			p.natsJetStream, err = p.natsConn.JetStream(nats.MaxWait(natsPublishTimeout))
+			if err != nil {
+				err = errors.Annotate(err, "NATS fail to create JetStream context")
+				return
+			}
+			logrus.WithFields(p.logContext).Debugln("enabling JetStream publishing")
+		}
+
+		go p.dealEventChan()
+
+		logrus.WithFields(p.logContext).Debugf("publishing to %s", p.subjectTemplate)
+	})
+
+	return err
+}
+
+func (p *natsPipe) Stop(ctx context.Context) int {
+	p.stopOnce.Do(func() {
+		logrus.WithFields(p.logContext).Debugln("stopping")
+
+		// a pipe which has never started can't start anymore, and has nothing to consume
+		p.Do(func() {
+			close(p.eventChanDone)
+		})
+
+		// refuse the new messages and close the queue, the queued messages
+		// are published until the context is done
+		p.Lock()
+		p.stopping = true
+		close(p.eventChan)
+		p.Unlock()
+
+		select {
+		case <-p.eventChanDone:
+		case <-ctx.Done():
+			// drop the remaining messages and abort the publishing
+			atomic.StoreInt32(&p.eventChanDrop, 1)
+			p.rootCancelFunc()
+			<-p.eventChanDone
+		}
+
+		p.rootCancelFunc()
+		if p.natsConn != nil {
+			// the published messages which can't be flushed until the deadline are lost
+			if atomic.LoadInt64(&p.unflushed) != 0 {
+				if err := p.natsConn.FlushWithContext(ctx); err != nil {
+					logrus.WithFields(p.logContext).WithError(err).Warnln("failed to flush")
+					atomic.AddInt64(&p.dropped, atomic.SwapInt64(&p.unflushed, 0))
+				}
+			}
+			p.natsConn.Close()
+		}
+
+		logrus.WithFields(p.logContext).Debugf("stopped, dropped %d events", atomic.LoadInt64(&p.dropped))
+	})
+
+	return int(atomic.LoadInt64(&p.dropped))
+}
+
+func (p *natsPipe) OnAdd(event *apiCoreV1.Event) error {
+	return p.publish("add", event)
+}
+
+func (p *natsPipe) OnUpdate(_ *apiCoreV1.Event, event *apiCoreV1.Event) error {
+	return p.publish("update", event)
+}
+
+func (p *natsPipe) OnDelete(event *apiCoreV1.Event) error {
+	return p.publish("delete", event)
+}
+
+func (p *natsPipe) OnList(eventList *apiCoreV1.EventList) error {
+	for i := range eventList.Items {
+		if err := p.publish("list", &eventList.Items[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *natsPipe) publish(operation string, event *apiCoreV1.Event) error {
+	encoded, err := p.encoder.Encode(operation, event)
+	if err != nil {
+		return err
+	}
+
+	msg := nats.NewMsg(p.subject(event))
+	msg.Data = encoded.Data
+	msg.Header.Set(natsOperationHeaderKey, operation)
+	msg.Header.Set(natsContentTypeHeaderKey, encoded.ContentType)
+	for name, value := range encoded.Attributes {
+		msg.Header.Set(natsAttributeHeaderPrefix+name, value)
+	}
+
+	if p.natsJetStream != nil {
+		// the JetStream server drops the message which has the same id
+		// inside the duplicate window of the stream
+		msg.Header.Set(nats.MsgIdHdr, natsMsgID(operation, event))
+	}
+
+	p.RLock()
+	defer p.RUnlock()
+
+	if p.stopping {
+		atomic.AddInt64(&p.dropped, 1)
+		return errors.New("pipe is stopping")
+	}
+
+	select {
+	case p.eventChan <- msg:
+		return nil
+	default:
+		atomic.AddInt64(&p.dropped, 1)
+		return errors.Errorf("dropping event %s, as the queue is full", event.UID)
+	}
+}
+
+func (p *natsPipe) dealEventChan() {
+	defer close(p.eventChanDone)
+
+	for msg := range p.eventChan {
+		if atomic.LoadInt32(&p.eventChanDrop) == 1 {
+			atomic.AddInt64(&p.dropped, 1)
+			continue
+		}
+
+		if err := p.deliver(msg); err != nil {
+			atomic.AddInt64(&p.dropped, 1)
+			logrus.WithFields(p.logContext).WithError(err).Errorf("failed to publish to %s", msg.Subject)
+		}
+
+		// flush the published messages once the queue is caught up
+		if len(p.eventChan) == 0 && atomic.LoadInt64(&p.unflushed) != 0 {
+			ctx, cancel := context.WithTimeout(p.rootCtx, natsPublishTimeout)
+			if err := p.natsConn.FlushWithContext(ctx); err == nil {
+				atomic.StoreInt64(&p.unflushed, 0)
+			}
+			cancel()
+		}
+	}
+}
+
+func (p *natsPipe) deliver(msg *nats.Msg) error {
+	if p.natsJetStream == nil {
+		if err := p.natsConn.PublishMsg(msg); err != nil {
+			return err
+		}
+		atomic.AddInt64(&p.unflushed, 1)
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(p.rootCtx, natsPublishTimeout)
+	defer cancel()
+
+	ack, err := p.natsJetStream.PublishMsg(msg, nats.Context(ctx))
+	if err != nil {
+		return errors.Annotatef(err, "can't publish to %s", msg.Subject)
+	}
+	if ack.Duplicate {
+		logrus.WithFields(p.logContext).Debugf("ignoring the duplicated event %s", msg.Header.Get(nats.MsgIdHdr))
+	}
+
+	return nil
+}
+
+// natsMsgID identifies a change of the event by its count, so that the addition,
+// the update and the relisting of the same change are deduplicated, e.g. after
+// restarting, only the deletion is kept apart from the last change.
+func natsMsgID(operation string, event *apiCoreV1.Event) string {
+	if operation == "delete" {
+		return fmt.Sprintf("%s-%d-delete", event.UID, event.Count)
+	}
+	return fmt.Sprintf("%s-%d", event.UID, event.Count)
+}
+
+func (p *natsPipe) subject(event *apiCoreV1.Event) string {
+	involvedObject := event.InvolvedObject
+
+	return strings.NewReplacer(
+		"{cluster}", natsSubjectToken(p.cluster),
+		"{namespace}", natsSubjectToken(involvedObject.Namespace),
+		"{kind}", natsSubjectToken(involvedObject.Kind),
+		"{name}", natsSubjectToken(involvedObject.Name),
+		"{type}", natsSubjectToken(event.Type),
+		"{reason}", natsSubjectToken(event.Reason),
+	).Replace(p.subjectTemplate)
+}
+
+// natsSubjectToken turns the value into a single subject token,
+// the separator and the wildcards are not allowed inside a token.
+func natsSubjectToken(value string) string {
+	if len(value) == 0 {
+		return natsBlankToken
+	}
+
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '.', '*', '>', ' ', '\t', '\r', '\n':
+			return '_'
+		}
+		return r
+	}, value)
+}
+
+func NewNats(name, cluster string, options Options) *natsPipe {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+
+	return &natsPipe{
+		logContext: logger.CreateLogContext("PIPE<"+name+">", cluster),
+		cluster:    cluster,
+		options:    options,
+
+		rootCtx:        ctx,
+		rootCancelFunc: cancelFunc,
+		eventChan:      make(chan *nats.Msg, natsQueueSize),
+		eventChanDone:  make(chan struct{}),
+	}
+}
@@ -0,0 +1,210 @@
+package pipes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	natsserver "github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	apiCoreV1 "k8s.io/api/core/v1"
+	apisMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func runNatsServer(t *testing.T, jetStream bool) *nats.Conn {
+	opts := natsserver.DefaultTestOptions
+	opts.Port = -1
+	opts.JetStream = jetStream
+	if jetStream {
+		opts.StoreDir = t.TempDir()
+	}
+
+	server := natsserver.RunServer(&opts)
+	t.Cleanup(server.Shutdown)
+
+	conn, err := nats.Connect(server.ClientURL())
+	if err != nil {
+		t.Fatalf("can't connect to the embedded server: %v", err)
+	}
+	t.Cleanup(conn.Close)
+
+	return conn
+}
+
+func startNatsPipe(t *testing.T, conn *nats.Conn, options Options) *natsPipe {
+	options[NatsURLEnvKey] = conn.ConnectedUrl()
+
+	p := NewNats("nats", "prod", options)
+	if err := p.Start(); err != nil {
+		t.Fatalf("can't start the pipe: %v", err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		p.Stop(ctx)
+	})
+
+	return p
+}
+
+func newNatsTestEvent() *apiCoreV1.Event {
+	return &apiCoreV1.Event{
+		ObjectMeta: apisMetaV1.ObjectMeta{UID: "e1"},
+		InvolvedObject: apiCoreV1.ObjectReference{
+			Namespace: "default",
+			Kind:      "Pod",
+			Name:      "nginx",
+		},
+		Reason: "BackOff",
+		Type:   apiCoreV1.EventTypeWarning,
+		Count:  3,
+	}
+}
+
+func TestNatsPublish(t *testing.T) {
+	conn := runNatsServer(t, false)
+
+	sub, err := conn.SubscribeSync("k8s.events.>")
+	if err != nil {
+		t.Fatalf("can't subscribe: %v", err)
+	}
+	if err := conn.Flush(); err != nil {
+		t.Fatalf("can't flush the subscription: %v", err)
+	}
+
+	p := startNatsPipe(t, conn, Options{
+		NatsSubjectTemplateEnvKey: "k8s.events.{cluster}.{namespace}.{kind}.{reason}",
+	})
+
+	tests := []struct {
+		operation string
+		publish   func(event *apiCoreV1.Event) error
+	}{
+		{operation: "add", publish: p.OnAdd},
+		{operation: "update", publish: func(event *apiCoreV1.Event) error { return p.OnUpdate(nil, event) }},
+		{operation: "delete", publish: p.OnDelete},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.operation, func(t *testing.T) {
+			if err := tt.publish(newNatsTestEvent()); err != nil {
+				t.Fatalf("can't publish: %v", err)
+			}
+
+			msg, err := sub.NextMsg(5 * time.Second)
+			if err != nil {
+				t.Fatalf("can't receive: %v", err)
+			}
+			if expected := "k8s.events.prod.default.Pod.BackOff"; msg.Subject != expected {
+				t.Errorf("expected subject %s but got %s", expected, msg.Subject)
+			}
+			if actual := msg.Header.Get(natsOperationHeaderKey); actual != tt.operation {
+				t.Errorf("expected operation %s but got %s", tt.operation, actual)
+			}
+			if actual := msg.Header.Get(natsContentTypeHeaderKey); actual != "application/json" {
+				t.Errorf("expected content type application/json but got %s", actual)
+			}
+			if actual := msg.Header.Get(nats.MsgIdHdr); len(actual) != 0 {
+				t.Errorf("expected no message id without JetStream but got %s", actual)
+			}
+		})
+	}
+}
+
+func TestNatsPublishJetStream(t *testing.T) {
+	conn := runNatsServer(t, true)
+
+	js, err := conn.JetStream()
+	if err != nil {
+		t.Fatalf("can't create JetStream context: %v", err)
+	}
+	if _, err := js.AddStream(&nats.StreamConfig{
+		Name:     "EVENTS",
+		Subjects: []string{"k8s.events.>"},
+	}); err != nil {
+		t.Fatalf("can't create stream: %v", err)
+	}
+
+	p := startNatsPipe(t, conn, Options{
+		NatsEnableJetStreamEnvKey: "true",
+	})
+
+	// the retried add and the relisting of the same count are dropped,
+	// the update of a new count and the deletion are kept
+	event := newNatsTestEvent()
+	updated := newNatsTestEvent()
+	updated.Count++
+	for _, publish := range []func() error{
+		func() error { return p.OnAdd(event) },
+		func() error { return p.OnAdd(event) },
+		func() error { return p.OnList(&apiCoreV1.EventList{Items: []apiCoreV1.Event{*event}}) },
+		func() error { return p.OnUpdate(event, updated) },
+		func() error { return p.OnDelete(updated) },
+	} {
+		if err := publish(); err != nil {
+			t.Fatalf("can't publish: %v", err)
+		}
+	}
+
+	// the stopping waits for the queued messages
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if dropped := p.Stop(ctx); dropped != 0 {
+		t.Errorf("expected no dropped messages but got %d", dropped)
+	}
+
+	info, err := js.StreamInfo("EVENTS")
+	if err != nil {
+		t.Fatalf("can't get stream info: %v", err)
+	}
+	if info.State.Msgs != 3 {
+		t.Errorf("expected 3 messages in the stream but got %d", info.State.Msgs)
+	}
+
+	msg, err := js.GetMsg("EVENTS", info.State.LastSeq)
+	if err != nil {
+		t.Fatalf("can't get the last message: %v", err)
+	}
+	if actual := msg.Header.Get(nats.MsgIdHdr); actual != "e1-4-delete" {
+		t.Errorf("expected message id e1-4-delete but got %s", actual)
+	}
+}
+
+func TestNatsSubjectToken(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected string
+	}{
+		{value: "", expected: "_"},
+		{value: "default", expected: "default"},
+		{value: "a.b", expected: "a_b"},
+		{value: "*>", expected: "__"},
+		{value: "Back Off", expected: "Back_Off"},
+	}
+
+	for _, tt := range tests {
+		if actual := natsSubjectToken(tt.value); actual != tt.expected {
+			t.Errorf("natsSubjectToken(%q): expected %q but got %q", tt.value, tt.expected, actual)
+		}
+	}
+}
+
+func TestNatsMsgID(t *testing.T) {
+	event := newNatsTestEvent()
+
+	tests := []struct {
+		operation string
+		expected  string
+	}{
+		{operation: "add", expected: "e1-3"},
+		{operation: "update", expected: "e1-3"},
+		{operation: "list", expected: "e1-3"},
+		{operation: "delete", expected: "e1-3-delete"},
+	}
+
+	for _, tt := range tests {
+		if actual := natsMsgID(tt.operation, event); actual != tt.expected {
+			t.Errorf("natsMsgID(%q): expected %q but got %q", tt.operation, tt.expected, actual)
+		}
+	}
+}
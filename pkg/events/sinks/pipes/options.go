@@ -0,0 +1,62 @@
+package pipes
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+const (
+	// fileKeySuffix names the option which refers to a file holding the value of an option,
+	// e.g. PIPE_MONGODB_PASSWORD_FILE refers to a Secret mounted as a file.
+	fileKeySuffix = "_FILE"
+	// envKeyPrefix prefixes the envs of all pipes.
+	envKeyPrefix = "PIPE_"
+)
+
+// Options configures a pipe by the same keys as its envs, e.g. PIPE_MONGODB_CONNECT_URI.
+// The options never read the envs by themselves, see NewEnvOptions.
+type Options map[string]string
+
+// NewEnvOptions returns the options falling back to the envs of the pipes, e.g. for the
+// pipes enabled by --use-pipe. The pipes declared by the namespace owners must not use it,
+// as the envs may hold the credentials of the exporter.
+func NewEnvOptions(options map[string]string) Options {
+	o := make(Options, len(options))
+	for _, env := range os.Environ() {
+		if kv := strings.SplitN(env, "=", 2); len(kv) == 2 && strings.HasPrefix(kv[0], envKeyPrefix) {
+			o[kv[0]] = kv[1]
+		}
+	}
+	for key, value := range options {
+		o[key] = value
+	}
+
+	return o
+}
+
+func (o Options) Get(key string) string {
+	return o[key]
+}
+
+// GetWithFile is like Get, but falls back to the content of the file referred by
+// the key with "_FILE" suffix, the trailing line breaks of the content are trimmed.
+func (o Options) GetWithFile(key string) (string, error) {
+	if value := o.Get(key); len(value) != 0 {
+		return value, nil
+	}
+
+	path := o.Get(key + fileKeySuffix)
+	if len(path) == 0 {
+		return "", nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", errors.Annotatef(err, `can't read "%s" option`, key+fileKeySuffix)
+	}
+
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
@@ -0,0 +1,76 @@
+package pipes
+
+import (
+	"context"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/streams"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/utils/logger"
+	apiCoreV1 "k8s.io/api/core/v1"
+)
+
+// streamPipe publishes the event changes of a cluster to the hub,
+// which serves the subscribers of the exporter APIs.
+type streamPipe struct {
+	logContext logrus.Fields
+	cluster    string
+
+	hub *streams.Hub
+
+	sync.Once
+}
+
+func (p *streamPipe) Start() error {
+	p.Do(func() {
+		logrus.WithFields(p.logContext).Debugln("starting")
+	})
+
+	return nil
+}
+
+func (p *streamPipe) Stop(_ context.Context) int {
+	logrus.WithFields(p.logContext).Debugln("stopped")
+
+	return 0
+}
+
+func (p *streamPipe) OnAdd(event *apiCoreV1.Event) error {
+	p.publish(streams.OperationAdd, event)
+	return nil
+}
+
+func (p *streamPipe) OnUpdate(_ *apiCoreV1.Event, event *apiCoreV1.Event) error {
+	p.publish(streams.OperationUpdate, event)
+	return nil
+}
+
+func (p *streamPipe) OnDelete(event *apiCoreV1.Event) error {
+	p.publish(streams.OperationDelete, event)
+	return nil
+}
+
+func (p *streamPipe) OnList(eventList *apiCoreV1.EventList) error {
+	for i := range eventList.Items {
+		p.publish(streams.OperationSync, &eventList.Items[i])
+	}
+
+	return nil
+}
+
+func (p *streamPipe) publish(operation streams.Operation, event *apiCoreV1.Event) {
+	p.hub.Publish(&streams.Event{
+		Cluster:   p.cluster,
+		Operation: operation,
+		Event:     event,
+	})
+}
+
+func NewStream(cluster string, hub *streams.Hub) *streamPipe {
+	return &streamPipe{
+		logContext: logger.CreateLogContext("PIPE<stream>", cluster),
+		cluster:    cluster,
+
+		hub: hub,
+	}
+}
@@ -0,0 +1,363 @@
+package pipes
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/encoding"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/utils/logger"
+	apiCoreV1 "k8s.io/api/core/v1"
+)
+
+const (
+	SyslogNetworkEnvKey               = "PIPE_SYSLOG_NETWORK"
+	SyslogAddressEnvKey               = "PIPE_SYSLOG_ADDRESS"
+	SyslogFacilityEnvKey              = "PIPE_SYSLOG_FACILITY"
+	SyslogAppNameEnvKey               = "PIPE_SYSLOG_APP_NAME"
+	SyslogTLSCAFileEnvKey             = "PIPE_SYSLOG_TLS_CA_FILE"
+	SyslogTLSInsecureSkipVerifyEnvKey = "PIPE_SYSLOG_TLS_INSECURE_SKIP_VERIFY"
+	SyslogEncodingEnvKey              = "PIPE_SYSLOG_ENCODING"
+
+	syslogDialTimeout   = 10 * time.Second
+	syslogWriteTimeout  = 10 * time.Second
+	syslogRedialBackoff = 1 * time.Second
+	syslogRedialRetries = 3
+	syslogQueueSize     = 1 << 16
+)
+
+type syslogUnit struct {
+	uid string
+	msg string
+}
+
+// syslogWriter sends the framed messages to the syslog server, the stream
+// transports (tcp, tls) use the octet counting framing of RFC 6587 and
+// are redialed when the connection breaks.
+type syslogWriter struct {
+	network   string
+	address   string
+	tlsConfig *tls.Config
+
+	conn net.Conn
+	sync.Mutex
+}
+
+func (w *syslogWriter) dial(ctx context.Context) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: syslogDialTimeout}
+	if w.network != "tls" {
+		return dialer.DialContext(ctx, w.network, w.address)
+	}
+
+	conn, err := dialer.DialContext(ctx, "tcp", w.address)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := w.tlsConfig.Clone()
+	if len(tlsConfig.ServerName) == 0 {
+		tlsConfig.ServerName, _, _ = net.SplitHostPort(w.address)
+	}
+	tlsConn := tls.Client(conn, tlsConfig)
+	tlsConn.SetDeadline(time.Now().Add(syslogDialTimeout))
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	tlsConn.SetDeadline(time.Time{})
+
+	return tlsConn, nil
+}
+
+func (w *syslogWriter) frame(msg string) []byte {
+	if w.network == "udp" {
+		return []byte(msg)
+	}
+
+	return []byte(fmt.Sprintf("%d %s", len(msg), msg))
+}
+
+// Write retries with the redialing until the context is done.
+func (w *syslogWriter) Write(ctx context.Context, msg string) error {
+	w.Lock()
+	defer w.Unlock()
+
+	data := w.frame(msg)
+
+	var lastErr error
+	for i := 0; i <= syslogRedialRetries; i++ {
+		if i != 0 {
+			select {
+			case <-ctx.Done():
+				return errors.Annotatef(lastErr, "aborted writing to %s://%s", w.network, w.address)
+			case <-time.After(time.Duration(i) * syslogRedialBackoff):
+			}
+		}
+
+		if w.conn == nil {
+			conn, err := w.dial(ctx)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			w.conn = conn
+		}
+
+		w.conn.SetWriteDeadline(time.Now().Add(syslogWriteTimeout))
+		if _, err := w.conn.Write(data); err != nil {
+			lastErr = err
+			w.conn.Close()
+			w.conn = nil
+			continue
+		}
+
+		return nil
+	}
+
+	return errors.Annotatef(lastErr, "can't write to %s://%s", w.network, w.address)
+}
+
+func (w *syslogWriter) Close() {
+	w.Lock()
+	defer w.Unlock()
+
+	if w.conn != nil {
+		w.conn.Close()
+		w.conn = nil
+	}
+}
+
+// syslogPipe sends each change of the events as a syslog message, the messages are
+// queued and written in order by a worker, so that a dead syslog server never blocks
+// the watching, the messages are dropped if the queue is full or can't be written.
+type syslogPipe struct {
+	logContext logrus.Fields
+	cluster    string
+	options    Options
+
+	rootCtx        context.Context
+	rootCancelFunc context.CancelFunc
+	eventChan      chan syslogUnit
+	eventChanDone  chan struct{}
+	eventChanDrop  int32
+	dropped        int64
+	stopping       bool
+
+	writer   *syslogWriter
+	facility int
+	appName  string
+	hostname string
+	// encoder encodes the MSG part, nil means the message of the event
+	encoder encoding.Encoder
+
+	stopOnce sync.Once
+
+	sync.RWMutex
+	sync.Once
+}
+
+func (p *syslogPipe) Start() (err error) {
+	p.Do(func() {
+		logrus.WithFields(p.logContext).Debugln("starting")
+
+		// the queue is never consumed if the starting fails
+		defer func() {
+			if err != nil {
+				close(p.eventChanDone)
+			}
+		}()
+
+		address := p.options.Get(SyslogAddressEnvKey)
+		if len(address) == 0 {
+			err = errors.Errorf(`"%s" option is required`, SyslogAddressEnvKey)
+			return
+		}
+
+		network := strings.ToLower(p.options.Get(SyslogNetworkEnvKey))
+		switch network {
+		case "":
+			network = "udp"
+		case "udp", "tcp":
+		case "tls":
+			tlsConfig := &tls.Config{
+				InsecureSkipVerify: strings.ToLower(p.options.Get(SyslogTLSInsecureSkipVerifyEnvKey)) == "true",
+			}
+			if caFile := p.options.Get(SyslogTLSCAFileEnvKey); len(caFile) != 0 {
+				caBytes, caErr := ioutil.ReadFile(caFile)
+				if caErr != nil {
+					err = errors.Annotatef(caErr, "can't read %s", caFile)
+					return
+				}
+
+				tlsConfig.RootCAs = x509.NewCertPool()
+				if !tlsConfig.RootCAs.AppendCertsFromPEM(caBytes) {
+					err = errors.Errorf("can't parse any certificate from %s", caFile)
+					return
+				}
+			}
+			p.writer.tlsConfig = tlsConfig
+		default:
+			err = errors.Errorf(`"%s" option only supports udp, tcp or tls, but got %s`, SyslogNetworkEnvKey, network)
+			return
+		}
+		p.writer.network = network
+		p.writer.address = address
+
+		facility := strings.ToLower(p.options.Get(SyslogFacilityEnvKey))
+		if len(facility) == 0 {
+			facility = "local0"
+		}
+		facilityCode, ok := syslogFacilities[facility]
+		if !ok {
+			err = errors.Errorf(`"%s" option doesn't support %s facility`, SyslogFacilityEnvKey, facility)
+			return
+		}
+		p.facility = facilityCode
+
+		p.appName = p.options.Get(SyslogAppNameEnvKey)
+		if len(p.appName) == 0 {
+			p.appName = "kubernetes-event-exporter"
+		}
+
+		p.hostname, _ = os.Hostname()
+
+		p.encoder, err = newEncoder(p.options, SyslogEncodingEnvKey, p.cluster, "")
+		if err != nil {
+			return
+		}
+
+		go p.dealEventChan()
+
+		logrus.WithFields(p.logContext).Debugf("sending to %s://%s with %s facility", network, address, facility)
+	})
+
+	return err
+}
+
+func (p *syslogPipe) Stop(ctx context.Context) int {
+	p.stopOnce.Do(func() {
+		logrus.WithFields(p.logContext).Debugln("stopping")
+
+		// a pipe which has never started can't start anymore, and has nothing to consume
+		p.Do(func() {
+			close(p.eventChanDone)
+		})
+
+		// refuse the new messages and close the queue, the queued messages
+		// are written until the context is done
+		p.Lock()
+		p.stopping = true
+		close(p.eventChan)
+		p.Unlock()
+
+		select {
+		case <-p.eventChanDone:
+		case <-ctx.Done():
+			// drop the remaining messages and abort the redialing
+			atomic.StoreInt32(&p.eventChanDrop, 1)
+			p.rootCancelFunc()
+			<-p.eventChanDone
+		}
+
+		p.rootCancelFunc()
+		p.writer.Close()
+
+		logrus.WithFields(p.logContext).Debugf("stopped, dropped %d events", atomic.LoadInt64(&p.dropped))
+	})
+
+	return int(atomic.LoadInt64(&p.dropped))
+}
+
+func (p *syslogPipe) OnAdd(event *apiCoreV1.Event) error {
+	return p.send("add", event)
+}
+
+func (p *syslogPipe) OnUpdate(_ *apiCoreV1.Event, event *apiCoreV1.Event) error {
+	return p.send("update", event)
+}
+
+func (p *syslogPipe) OnDelete(event *apiCoreV1.Event) error {
+	logrus.WithFields(p.logContext).Debugln("ignoring the deletion operation")
+	return nil
+}
+
+func (p *syslogPipe) OnList(eventList *apiCoreV1.EventList) error {
+	for i := range eventList.Items {
+		if err := p.send("list", &eventList.Items[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *syslogPipe) send(operation string, event *apiCoreV1.Event) error {
+	msg := event.Message
+	if p.encoder != nil {
+		encoded, err := p.encoder.Encode(operation, event)
+		if err != nil {
+			return err
+		}
+		// a message is a single line, e.g. a csv row ends with a line break
+		msg = strings.TrimRight(string(encoded.Data), "\r\n")
+	}
+
+	p.RLock()
+	defer p.RUnlock()
+
+	if p.stopping {
+		atomic.AddInt64(&p.dropped, 1)
+		return errors.New("pipe is stopping")
+	}
+
+	select {
+	case p.eventChan <- syslogUnit{uid: string(event.UID), msg: formatSyslogMessage(p.facility, p.hostname, p.appName, p.cluster, event, msg)}:
+		return nil
+	default:
+		atomic.AddInt64(&p.dropped, 1)
+		return errors.Errorf("dropping event %s, as the queue is full", event.UID)
+	}
+}
+
+func (p *syslogPipe) dealEventChan() {
+	defer close(p.eventChanDone)
+
+	for unit := range p.eventChan {
+		if atomic.LoadInt32(&p.eventChanDrop) == 1 {
+			atomic.AddInt64(&p.dropped, 1)
+			continue
+		}
+
+		if err := p.writer.Write(p.rootCtx, unit.msg); err != nil {
+			atomic.AddInt64(&p.dropped, 1)
+			logrus.WithFields(p.logContext).WithError(err).Errorf("failed to send event %s", unit.uid)
+		}
+	}
+}
+
+func NewSyslog(name, cluster string, options Options) *syslogPipe {
+	ctx, cancelFunc := context.WithCancel(context.Background())
+
+	return &syslogPipe{
+		logContext: logger.CreateLogContext("PIPE<"+name+">", cluster),
+		cluster:    cluster,
+		options:    options,
+
+		rootCtx:        ctx,
+		rootCancelFunc: cancelFunc,
+		eventChan:      make(chan syslogUnit, syslogQueueSize),
+		eventChanDone:  make(chan struct{}),
+
+		writer: &syslogWriter{},
+	}
+}
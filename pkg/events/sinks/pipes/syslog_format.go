@@ -0,0 +1,120 @@
+package pipes
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	apiCoreV1 "k8s.io/api/core/v1"
+)
+
+const (
+	syslogVersion  = 1
+	syslogNilValue = "-"
+	// 32473 is the private enterprise number reserved for documentation (RFC 5612),
+	// it keeps the structured data element id well-formed without registering one.
+	syslogSDID            = "k8s@32473"
+	syslogTimestampLayout = "2006-01-02T15:04:05.000000Z07:00"
+
+	syslogSeverityWarning = 4
+	syslogSeverityInfo    = 6
+)
+
+var syslogFacilities = map[string]int{
+	"kern":     0,
+	"user":     1,
+	"mail":     2,
+	"daemon":   3,
+	"auth":     4,
+	"syslog":   5,
+	"lpr":      6,
+	"news":     7,
+	"uucp":     8,
+	"cron":     9,
+	"authpriv": 10,
+	"ftp":      11,
+	"local0":   16,
+	"local1":   17,
+	"local2":   18,
+	"local3":   19,
+	"local4":   20,
+	"local5":   21,
+	"local6":   22,
+	"local7":   23,
+}
+
+func syslogSeverity(event *apiCoreV1.Event) int {
+	if event.Type == apiCoreV1.EventTypeWarning {
+		return syslogSeverityWarning
+	}
+
+	return syslogSeverityInfo
+}
+
+// syslogHeaderValue cuts the value down to the printable US-ASCII characters
+// and the maximum length allowed by a RFC 5424 header field.
+func syslogHeaderValue(value string, maxLen int) string {
+	builder := strings.Builder{}
+	for i := 0; i < len(value) && builder.Len() < maxLen; i++ {
+		if c := value[i]; c >= 33 && c <= 126 {
+			builder.WriteByte(c)
+		}
+	}
+
+	if builder.Len() == 0 {
+		return syslogNilValue
+	}
+
+	return builder.String()
+}
+
+// syslogParamValue escapes the characters which must not appear
+// unescaped inside a RFC 5424 structured data parameter value.
+func syslogParamValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(value)
+}
+
+func formatSyslogMessage(facility int, hostname, appName, cluster string, event *apiCoreV1.Event, msg string) string {
+	involvedObject := event.InvolvedObject
+
+	timestamp := event.LastTimestamp.Time
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+
+	builder := strings.Builder{}
+	fmt.Fprintf(&builder, "<%d>%d %s %s %s %s %s ",
+		facility*8+syslogSeverity(event),
+		syslogVersion,
+		timestamp.UTC().Format(syslogTimestampLayout),
+		syslogHeaderValue(hostname, 255),
+		syslogHeaderValue(appName, 48),
+		syslogNilValue,
+		syslogHeaderValue(event.Reason, 32),
+	)
+
+	builder.WriteString("[" + syslogSDID)
+	for _, param := range [][2]string{
+		{"cluster", cluster},
+		{"namespace", involvedObject.Namespace},
+		{"kind", involvedObject.Kind},
+		{"name", involvedObject.Name},
+		{"reason", event.Reason},
+		{"type", event.Type},
+		{"count", strconv.Itoa(int(event.Count))},
+		{"uid", string(event.UID)},
+	} {
+		if len(param[1]) != 0 {
+			fmt.Fprintf(&builder, ` %s="%s"`, param[0], syslogParamValue(param[1]))
+		}
+	}
+	builder.WriteString("]")
+
+	if len(msg) != 0 {
+		builder.WriteString(" ")
+		builder.WriteString(msg)
+	}
+
+	return builder.String()
+}
@@ -0,0 +1,104 @@
+package pipes
+
+import (
+	"testing"
+	"time"
+
+	apiCoreV1 "k8s.io/api/core/v1"
+	apisMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestFormatSyslogMessage(t *testing.T) {
+	lastTimestamp := apisMetaV1.NewTime(time.Date(2020, 1, 2, 3, 4, 5, 6000, time.UTC))
+
+	tests := []struct {
+		name     string
+		facility int
+		hostname string
+		appName  string
+		event    *apiCoreV1.Event
+		msg      string
+		expected string
+	}{
+		{
+			name:     "warning of a namespaced object",
+			facility: syslogFacilities["local0"],
+			hostname: "exporter-0",
+			appName:  "kubernetes-event-exporter",
+			event: &apiCoreV1.Event{
+				ObjectMeta: apisMetaV1.ObjectMeta{UID: "e1"},
+				InvolvedObject: apiCoreV1.ObjectReference{
+					Namespace: "default",
+					Kind:      "Pod",
+					Name:      "nginx",
+				},
+				Reason:        "BackOff",
+				Type:          apiCoreV1.EventTypeWarning,
+				Count:         3,
+				LastTimestamp: lastTimestamp,
+			},
+			msg:      "Back-off restarting failed container",
+			expected: `<132>1 2020-01-02T03:04:05.000006Z exporter-0 kubernetes-event-exporter - BackOff [k8s@32473 cluster="prod" namespace="default" kind="Pod" name="nginx" reason="BackOff" type="Warning" count="3" uid="e1"] Back-off restarting failed container`,
+		},
+		{
+			name:     "normal event of a cluster scoped object without message",
+			facility: syslogFacilities["user"],
+			hostname: "exporter-0",
+			appName:  "exporter",
+			event: &apiCoreV1.Event{
+				InvolvedObject: apiCoreV1.ObjectReference{
+					Kind: "Node",
+					Name: "node-1",
+				},
+				Reason:        "NodeReady",
+				Type:          apiCoreV1.EventTypeNormal,
+				LastTimestamp: lastTimestamp,
+			},
+			expected: `<14>1 2020-01-02T03:04:05.000006Z exporter-0 exporter - NodeReady [k8s@32473 cluster="prod" kind="Node" name="node-1" reason="NodeReady" type="Normal" count="0"]`,
+		},
+		{
+			name:     "blank and unprintable header values",
+			facility: syslogFacilities["daemon"],
+			hostname: "",
+			appName:  "exporter with spaces",
+			event: &apiCoreV1.Event{
+				InvolvedObject: apiCoreV1.ObjectReference{
+					Kind: "Pod",
+					Name: `a"b]c\d`,
+				},
+				LastTimestamp: lastTimestamp,
+			},
+			msg:      "message",
+			expected: `<30>1 2020-01-02T03:04:05.000006Z - exporterwithspaces - - [k8s@32473 cluster="prod" kind="Pod" name="a\"b\]c\\d" count="0"] message`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual := formatSyslogMessage(tt.facility, tt.hostname, tt.appName, "prod", tt.event, tt.msg)
+			if actual != tt.expected {
+				t.Errorf("expected\n%s\nbut got\n%s", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestSyslogHeaderValue(t *testing.T) {
+	tests := []struct {
+		value    string
+		maxLen   int
+		expected string
+	}{
+		{value: "", maxLen: 48, expected: "-"},
+		{value: " \t\n", maxLen: 48, expected: "-"},
+		{value: "app name", maxLen: 48, expected: "appname"},
+		{value: "abcdef", maxLen: 3, expected: "abc"},
+		{value: "héllo", maxLen: 48, expected: "hllo"},
+	}
+
+	for _, tt := range tests {
+		if actual := syslogHeaderValue(tt.value, tt.maxLen); actual != tt.expected {
+			t.Errorf("syslogHeaderValue(%q, %d): expected %q but got %q", tt.value, tt.maxLen, tt.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package pipes
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	apiCoreV1 "k8s.io/api/core/v1"
+	apisMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newSyslogTestEvent() *apiCoreV1.Event {
+	return &apiCoreV1.Event{
+		ObjectMeta: apisMetaV1.ObjectMeta{UID: "e1"},
+		InvolvedObject: apiCoreV1.ObjectReference{
+			Namespace: "default",
+			Kind:      "Pod",
+			Name:      "nginx",
+		},
+		Reason:  "BackOff",
+		Type:    apiCoreV1.EventTypeWarning,
+		Message: "Back-off restarting failed container",
+	}
+}
+
+func TestSyslogSend(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("can't listen: %v", err)
+	}
+	defer listener.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		received <- line
+	}()
+
+	p := NewSyslog("syslog", "prod", Options{
+		SyslogNetworkEnvKey: "tcp",
+		SyslogAddressEnvKey: listener.Addr().String(),
+	})
+	if err := p.Start(); err != nil {
+		t.Fatalf("can't start the pipe: %v", err)
+	}
+
+	// the message is framed by its length, and written by the worker
+	event := newSyslogTestEvent()
+	event.Message = "line\n"
+	if err := p.OnAdd(event); err != nil {
+		t.Fatalf("can't send: %v", err)
+	}
+
+	select {
+	case line := <-received:
+		if !strings.Contains(line, "kubernetes-event-exporter") || !strings.HasSuffix(line, "line\n") {
+			t.Errorf("expected the message of the event but got %q", line)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a message but got nothing")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if dropped := p.Stop(ctx); dropped != 0 {
+		t.Errorf("expected no dropped messages but got %d", dropped)
+	}
+}
+
+func TestSyslogSendNeverBlocks(t *testing.T) {
+	// nothing listens on the closed port, so the worker keeps redialing
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("can't listen: %v", err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	p := NewSyslog("syslog", "prod", Options{
+		SyslogNetworkEnvKey: "tcp",
+		SyslogAddressEnvKey: address,
+	})
+	if err := p.Start(); err != nil {
+		t.Fatalf("can't start the pipe: %v", err)
+	}
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := p.OnAdd(newSyslogTestEvent()); err != nil {
+			t.Fatalf("can't send: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected sending without waiting for the server but took %s", elapsed)
+	}
+
+	// the messages can't be written are counted as dropped on stopping
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if dropped := p.Stop(ctx); dropped != 3 {
+		t.Errorf("expected 3 dropped messages but got %d", dropped)
+	}
+	if err := p.OnAdd(newSyslogTestEvent()); err == nil {
+		t.Error("expected error after stopping but got nil")
+	}
+}
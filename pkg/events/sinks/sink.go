@@ -1,17 +1,33 @@
 package sinks
 
 import (
-	"fmt"
+	"context"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/juju/errors"
 	"github.com/sirupsen/logrus"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/classify"
 	"github.com/thxcode/kubernetes-event-exporter/pkg/events"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/expressions"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/limits"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/metrics"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/routes"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/streams"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/transforms"
 	"github.com/thxcode/kubernetes-event-exporter/pkg/utils/logger"
 	apiCoreV1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/util/wait"
 )
 
+const (
+	// summaryCheckPeriod is the period for checking whether the limiter summarizes.
+	summaryCheckPeriod = 10 * time.Second
+	// pipesRollbackTimeout bounds the stopping of the pipes if the sink fails to start.
+	pipesRollbackTimeout = 10 * time.Second
+)
+
 type Handle uint64
 
 const (
@@ -19,6 +35,7 @@ const (
 	OnUpdate
 	OnDelete
 	OnList
+	OnExpire
 )
 
 // Sink interface represents a generic sink that is responsible for handling
@@ -32,149 +49,469 @@ type Sink interface {
 
 	OnList(eventList *apiCoreV1.EventList)
 
-	Run(stopCh <-chan struct{}) error
+	Start() error
+	Stop(ctx context.Context) int
 }
 
 type DefaultSinkConfig struct {
-	KubernetesHost string
-	Pipes          []Pipe
-	PipesParallel  bool
+	ClusterName   string
+	Pipes         map[string]Pipe
+	PipesParallel bool
+	// OptionalPipes are skipped rather than failing the sink if they can't start.
+	OptionalPipes map[string]struct{}
+	// DropRules drops the events matching any of them before reaching the pipes.
+	DropRules []*streams.Filter
+	// Transforms transforms the kept events before reaching the pipes.
+	Transforms *transforms.Chain
+	// Classifier labels the transformed events by their severities and categories.
+	Classifier *classify.Classifier
+	// Routes selects the pipes of the transformed events, nil means all pipes.
+	Routes *routes.Table
+	// Limiter suppresses the flooding additions and updates, nil means unlimited.
+	Limiter *limits.Limiter
+	// Enricher gets the data referred by the expressions of the drop rules and the routes.
+	Enricher expressions.Enricher
 }
 
 type DefaultSink struct {
 	logContext logrus.Fields
 
-	pipesMap        map[string]Pipe
+	clusterName     string
 	isPipesParallel bool
+
+	pipesMap      map[string]Pipe
+	optionalPipes map[string]struct{}
+	dropRules     []*streams.Filter
+	transforms    *transforms.Chain
+	classifier    *classify.Classifier
+	routes        *routes.Table
+	limiter       *limits.Limiter
+	enricher      expressions.Enricher
+	stopCh        chan struct{}
+	sync.RWMutex
 }
 
 func (s *DefaultSink) OnAdd(event *apiCoreV1.Event) {
-	g := wait.Group{}
-	defer g.Wait()
+	s.dispatch(event, true, func(pipe Pipe, event *apiCoreV1.Event) error {
+		return pipe.OnAdd(event)
+	})
+}
 
-	for pipeName, pipe := range s.pipesMap {
-		if s.isPipesParallel {
-			func(pipeName string, pipe Pipe) {
-				g.Start(func() {
-					if err := pipe.OnAdd(event); err != nil {
-						logrus.WithFields(s.logContext).WithError(err).Errorf("%s error occur", pipeName)
-					}
-				})
-			}(pipeName, pipe)
-		} else {
-			if err := pipe.OnAdd(event); err != nil {
-				logrus.WithFields(s.logContext).WithError(err).Errorf("%s error occur", pipeName)
-				break
-			}
-		}
+func (s *DefaultSink) OnUpdate(oldEvent *apiCoreV1.Event, newEvent *apiCoreV1.Event) {
+	s.RLock()
+	defer s.RUnlock()
+
+	newEvent, ok := s.prepare(newEvent)
+	if !ok || !s.admit(newEvent) {
+		return
+	}
+	// the old event is only dropped if it fails to transform, and is classified
+	// as the new one, so that the pipes compare the events in the same form
+	if oldEvent, ok = s.transform(oldEvent); !ok {
+		return
 	}
+	oldEvent = s.classifier.Apply(oldEvent)
+
+	s.fanOut(s.routes.Route(s.clusterName, newEvent, s.enricher), func(_ string, pipe Pipe) error {
+		return pipe.OnUpdate(oldEvent, newEvent)
+	})
 }
 
-func (s *DefaultSink) OnUpdate(oldEvent *apiCoreV1.Event, newEvent *apiCoreV1.Event) {
-	g := wait.Group{}
-	defer g.Wait()
+func (s *DefaultSink) OnDelete(event *apiCoreV1.Event) {
+	s.dispatch(event, false, func(pipe Pipe, event *apiCoreV1.Event) error {
+		return pipe.OnDelete(event)
+	})
+}
 
-	for pipeName, pipe := range s.pipesMap {
-		if s.isPipesParallel {
-			func(pipeName string, pipe Pipe) {
-				g.Start(func() {
-					if err := pipe.OnUpdate(oldEvent, newEvent); err != nil {
-						logrus.WithFields(s.logContext).WithError(err).Errorf("%s error occur", pipeName)
-					}
-				})
-			}(pipeName, pipe)
-		} else {
-			if err := pipe.OnUpdate(oldEvent, newEvent); err != nil {
-				logrus.WithFields(s.logContext).WithError(err).Errorf("%s error occur", pipeName)
-				break
+func (s *DefaultSink) OnExpire(event *apiCoreV1.Event) {
+	s.dispatch(event, false, func(pipe Pipe, event *apiCoreV1.Event) error {
+		if expirationPipe, ok := pipe.(ExpirationPipe); ok {
+			return expirationPipe.OnExpire(event)
+		}
+		return nil
+	})
+}
+
+func (s *DefaultSink) OnList(eventList *apiCoreV1.EventList) {
+	s.RLock()
+	defer s.RUnlock()
+
+	// the listed events are prepared as the watched ones, e.g. classified
+	keptEventList := &apiCoreV1.EventList{
+		TypeMeta: eventList.TypeMeta,
+		ListMeta: eventList.ListMeta,
+		Items:    make([]apiCoreV1.Event, 0, len(eventList.Items)),
+	}
+	for i := range eventList.Items {
+		if event, ok := s.prepare(&eventList.Items[i]); ok {
+			keptEventList.Items = append(keptEventList.Items, *event)
+		}
+	}
+	eventList = keptEventList
+
+	// each pipe lists the events routed to it
+	var routedEventLists map[string]*apiCoreV1.EventList
+	if s.routes != nil {
+		routedEventLists = make(map[string]*apiCoreV1.EventList, len(s.pipesMap))
+		for pipeName := range s.pipesMap {
+			routedEventLists[pipeName] = &apiCoreV1.EventList{
+				TypeMeta: eventList.TypeMeta,
+				ListMeta: eventList.ListMeta,
+				Items:    make([]apiCoreV1.Event, 0),
+			}
+		}
+		for i := range eventList.Items {
+			targets := s.routes.Route(s.clusterName, &eventList.Items[i], s.enricher)
+			for pipeName, routedEventList := range routedEventLists {
+				if isTarget(targets, pipeName) {
+					routedEventList.Items = append(routedEventList.Items, eventList.Items[i])
+				}
 			}
 		}
 	}
+
+	s.fanOut(nil, func(pipeName string, pipe Pipe) error {
+		if routedEventLists != nil {
+			return pipe.OnList(routedEventLists[pipeName])
+		}
+		return pipe.OnList(eventList)
+	})
 }
 
-func (s *DefaultSink) OnDelete(event *apiCoreV1.Event) {
+// Add hands the event to the pipes as OnAdd does, and returns the error if any pipe
+// fails to handle it, e.g. for counting the failures of replaying.
+func (s *DefaultSink) Add(event *apiCoreV1.Event) error {
+	if failed := s.dispatch(event, true, func(pipe Pipe, event *apiCoreV1.Event) error {
+		return pipe.OnAdd(event)
+	}); failed != 0 {
+		return errors.Errorf("%d pipes failed to handle event %s/%s", failed, event.Namespace, event.Name)
+	}
+	return nil
+}
+
+// dispatch hands the kept event to each pipe after transforming, and returns the count
+// of the failed pipes, the limited event may be suppressed by the limiter.
+func (s *DefaultSink) dispatch(event *apiCoreV1.Event, limited bool, handle func(pipe Pipe, event *apiCoreV1.Event) error) int {
+	s.RLock()
+	defer s.RUnlock()
+
+	event, ok := s.prepare(event)
+	if !ok || (limited && !s.admit(event)) {
+		return 0
+	}
+
+	return s.fanOut(s.routes.Route(s.clusterName, event, s.enricher), func(_ string, pipe Pipe) error {
+		return handle(pipe, event)
+	})
+}
+
+// View returns the event as the pipes receive it, or false if it is dropped,
+// so that the listing of the stored events applies the same rules.
+func (s *DefaultSink) View(event *apiCoreV1.Event) (*apiCoreV1.Event, bool) {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.prepare(event)
+}
+
+// prepare must be called with the read lock held, it returns false if the event is dropped.
+func (s *DefaultSink) prepare(event *apiCoreV1.Event) (*apiCoreV1.Event, bool) {
+	if s.isDropped(event) {
+		return nil, false
+	}
+
+	event, ok := s.transform(event)
+	if !ok {
+		return nil, false
+	}
+
+	return s.classifier.Apply(event), true
+}
+
+// admit must be called with the read lock held, it returns false if the addition
+// or the updating is suppressed by the limiter.
+func (s *DefaultSink) admit(event *apiCoreV1.Event) bool {
+	if !s.limiter.Allow(event) {
+		metrics.ObserveSuppressed(s.clusterName, event)
+		return false
+	}
+
+	metrics.ObserveEvent(s.clusterName, event)
+	return true
+}
+
+// fanOut must be called with the read lock held, it only hands to the targets and
+// returns the count of the failed pipes, nil targets means all pipes.
+func (s *DefaultSink) fanOut(targets map[string]struct{}, handle func(pipeName string, pipe Pipe) error) int {
+	var failed int64
 	g := wait.Group{}
-	defer g.Wait()
 
 	for pipeName, pipe := range s.pipesMap {
+		if !isTarget(targets, pipeName) {
+			continue
+		}
+
 		if s.isPipesParallel {
 			func(pipeName string, pipe Pipe) {
 				g.Start(func() {
-					if err := pipe.OnDelete(event); err != nil {
+					if err := handle(pipeName, pipe); err != nil {
 						logrus.WithFields(s.logContext).WithError(err).Errorf("%s error occur", pipeName)
+						atomic.AddInt64(&failed, 1)
 					}
 				})
 			}(pipeName, pipe)
 		} else {
-			if err := pipe.OnDelete(event); err != nil {
+			if err := handle(pipeName, pipe); err != nil {
 				logrus.WithFields(s.logContext).WithError(err).Errorf("%s error occur", pipeName)
-				break
+				failed++
 			}
 		}
 	}
+
+	g.Wait()
+	return int(failed)
 }
 
-func (s *DefaultSink) OnList(eventList *apiCoreV1.EventList) {
-	g := wait.Group{}
-	defer g.Wait()
+// summarize must be called with the read lock held, it hands the summary records
+// of the suppressed events to the pipes as additions.
+func (s *DefaultSink) summarize(limiter *limits.Limiter, force bool) {
+	summaries := limiter.Summarize(force)
+	if len(summaries) == 0 {
+		return
+	}
+	logrus.WithFields(s.logContext).Infof("summarizing suppressed events of %d keys, %d suppressed in total", len(summaries), limiter.Suppressed())
 
-	for pipeName, pipe := range s.pipesMap {
-		if s.isPipesParallel {
-			func(pipeName string, pipe Pipe) {
-				g.Start(func() {
-					if err := pipe.OnList(eventList); err != nil {
-						logrus.WithFields(s.logContext).WithError(err).Errorf("%s error occur", pipeName)
-					}
-				})
-			}(pipeName, pipe)
-		} else {
-			if err := pipe.OnList(eventList); err != nil {
-				logrus.WithFields(s.logContext).WithError(err).Errorf("%s error occur", pipeName)
-				break
-			}
+	for _, summary := range summaries {
+		s.fanOut(s.routes.Route(s.clusterName, summary, s.enricher), func(_ string, pipe Pipe) error {
+			return pipe.OnAdd(summary)
+		})
+	}
+}
+
+func isTarget(targets map[string]struct{}, pipeName string) bool {
+	if targets == nil {
+		return true
+	}
+
+	_, ok := targets[pipeName]
+	return ok
+}
+
+// transform must be called with the read lock held, the event failing to be
+// transformed is dropped, so that a failed redaction never leaks.
+func (s *DefaultSink) transform(event *apiCoreV1.Event) (*apiCoreV1.Event, bool) {
+	transformed, err := s.transforms.Apply(s.clusterName, event)
+	if err != nil {
+		logrus.WithFields(s.logContext).WithError(err).Errorf("dropping event %s failed to transform", event.UID)
+		return nil, false
+	}
+
+	return transformed, true
+}
+
+// isDropped must be called with the read lock held.
+func (s *DefaultSink) isDropped(event *apiCoreV1.Event) bool {
+	for _, rule := range s.dropRules {
+		if rule.MatchEnriched(s.clusterName, event, s.enricher) {
+			return true
 		}
 	}
+
+	return false
 }
 
-func (s *DefaultSink) Run(stopCh <-chan struct{}) error {
+func (s *DefaultSink) Start() error {
 	for {
 		select {
 		case <-time.Tick(30 * time.Second):
 			return errors.New("timeout on pipes starting")
 		default:
 			logrus.WithFields(s.logContext).Debugf("prepare pipes")
-			for _, pipe := range s.pipesMap {
-				if err := pipe.Start(); err != nil {
-					return errors.Annotatef(err, "%T starting error", pipe)
-				}
+			ctx, cancelFunc := context.WithTimeout(context.Background(), pipesRollbackTimeout)
+			s.Lock()
+			started, err := startPipes(ctx, s.logContext, s.pipesMap, s.optionalPipes)
+			if err == nil {
+				s.pipesMap = started
+			}
+			s.Unlock()
+			cancelFunc()
+			if err != nil {
+				return err
 			}
 			logrus.WithFields(s.logContext).Debugf("running pipes")
 
-			go func() {
-				<-stopCh
+			go wait.Until(func() {
+				s.RLock()
+				defer s.RUnlock()
 
-				logrus.WithFields(s.logContext).Debugf("stopping pipes")
-				for _, pipe := range s.pipesMap {
-					pipe.Stop()
-				}
-				logrus.WithFields(s.logContext).Debugf("stopped pipes")
-			}()
+				s.summarize(s.limiter, false)
+			}, summaryCheckPeriod, s.stopCh)
 
 			return nil
 		}
 	}
 }
 
-func NewDefaultSink(config *DefaultSinkConfig) (*DefaultSink, error) {
-	pipesMap := make(map[string]Pipe, len(config.Pipes))
+// Has returns true if the sink runs the pipe, an optional pipe is skipped if it fails to start.
+func (s *DefaultSink) Has(pipeName string) bool {
+	s.RLock()
+	defer s.RUnlock()
+
+	_, ok := s.pipesMap[pipeName]
+	return ok
+}
+
+// Prepare starts the pipes which the sink doesn't run yet, and returns the pipes for reloading,
+// an optional pipe which fails to start is stopped and left out. If any other pipe fails to start,
+// all the given pipes which the sink doesn't run are stopped within the context.
+func (s *DefaultSink) Prepare(ctx context.Context, pipesMap map[string]Pipe, optionalPipes map[string]struct{}) (map[string]Pipe, error) {
+	s.RLock()
+	running := make(map[Pipe]struct{}, len(s.pipesMap))
+	for _, pipe := range s.pipesMap {
+		running[pipe] = struct{}{}
+	}
+	s.RUnlock()
+
+	prepared := make(map[string]Pipe, len(pipesMap))
+	added := make(map[string]Pipe)
+	for pipeName, pipe := range pipesMap {
+		if _, ok := running[pipe]; ok {
+			prepared[pipeName] = pipe
+		} else {
+			added[pipeName] = pipe
+		}
+	}
 
-	for _, pipe := range config.Pipes {
-		pipesMap[fmt.Sprintf("%T", pipe)] = pipe
+	started, err := startPipes(ctx, s.logContext, added, optionalPipes)
+	if err != nil {
+		return nil, err
+	}
+	for pipeName, pipe := range started {
+		prepared[pipeName] = pipe
 	}
 
+	return prepared, nil
+}
+
+// Reload replaces the pipes, the drop rules, the transforms, the classifier, the routes
+// and the limiter without stopping the sink. The pipes must be prepared, the pipes which are
+// kept by the same instance keep running, and the removed pipes are stopped within the context
+// after the replacing. A replaced limiter summarizes its suppressed events at once.
+func (s *DefaultSink) Reload(ctx context.Context, pipesMap map[string]Pipe, dropRules []*streams.Filter, chain *transforms.Chain, classifier *classify.Classifier, table *routes.Table, limiter *limits.Limiter) {
+	s.Lock()
+	removed := make(map[string]Pipe)
+	kept := make(map[Pipe]struct{}, len(pipesMap))
+	for _, pipe := range pipesMap {
+		kept[pipe] = struct{}{}
+	}
+	added := len(pipesMap)
+	for pipeName, pipe := range s.pipesMap {
+		if _, ok := kept[pipe]; !ok {
+			removed[pipeName] = pipe
+		} else {
+			added--
+		}
+	}
+	s.pipesMap = pipesMap
+	s.dropRules = dropRules
+	s.transforms = chain
+	s.classifier = classifier
+	s.routes = table
+	previousLimiter := s.limiter
+	s.limiter = limiter
+	s.Unlock()
+
+	if previousLimiter != limiter {
+		s.RLock()
+		s.summarize(previousLimiter, true)
+		s.RUnlock()
+	}
+
+	logrus.WithFields(s.logContext).Infof("reloaded pipes, %d added, %d removed, %d kept", added, len(removed), len(pipesMap)-added)
+	stopPipes(ctx, s.logContext, removed)
+}
+
+// Stop stops the pipes in parallel, each pipe flushes its queued events until
+// the context is done. It returns the total count of the dropped events.
+func (s *DefaultSink) Stop(ctx context.Context) int {
+	logrus.WithFields(s.logContext).Debugf("stopping pipes")
+
+	close(s.stopCh)
+
+	s.RLock()
+	s.summarize(s.limiter, true)
+	dropped := stopPipes(ctx, s.logContext, s.pipesMap)
+	s.RUnlock()
+
+	logrus.WithFields(s.logContext).Debugf("stopped pipes")
+	return dropped
+}
+
+// startPipes starts the pipes and returns the running ones, an optional pipe which fails
+// to start is stopped and left out. If any other pipe fails to start, all the pipes
+// are stopped within the context, as the sink may be recreated by the caller.
+func startPipes(ctx context.Context, logContext logrus.Fields, pipesMap map[string]Pipe, optionalPipes map[string]struct{}) (map[string]Pipe, error) {
+	started := make(map[string]Pipe, len(pipesMap))
+	skipped := make(map[string]struct{})
+	for pipeName, pipe := range pipesMap {
+		err := pipe.Start()
+		if err == nil {
+			started[pipeName] = pipe
+			continue
+		}
+
+		if _, ok := optionalPipes[pipeName]; ok {
+			logrus.WithFields(logContext).WithError(err).Warnf("skipping pipe %s", pipeName)
+			pipe.Stop(ctx)
+			skipped[pipeName] = struct{}{}
+			continue
+		}
+
+		// the pipes which haven't started never start after stopping
+		stopping := make(map[string]Pipe, len(pipesMap)-len(skipped))
+		for name, pipe := range pipesMap {
+			if _, ok := skipped[name]; !ok {
+				stopping[name] = pipe
+			}
+		}
+		stopPipes(ctx, logContext, stopping)
+		return nil, errors.Annotatef(err, "%s starting error", pipeName)
+	}
+
+	return started, nil
+}
+
+func stopPipes(ctx context.Context, logContext logrus.Fields, pipesMap map[string]Pipe) int {
+	var dropped int64
+	g := wait.Group{}
+	for pipeName, pipe := range pipesMap {
+		func(pipeName string, pipe Pipe) {
+			g.Start(func() {
+				if n := pipe.Stop(ctx); n != 0 {
+					logrus.WithFields(logContext).Warnf("%s dropped %d events", pipeName, n)
+					atomic.AddInt64(&dropped, int64(n))
+				}
+			})
+		}(pipeName, pipe)
+	}
+	g.Wait()
+
+	return int(dropped)
+}
+
+func NewDefaultSink(config *DefaultSinkConfig) (*DefaultSink, error) {
 	return &DefaultSink{
-		logContext:      logger.CreateLogContext("SINK", config.KubernetesHost),
-		pipesMap:        pipesMap,
+		logContext:      logger.CreateLogContext("SINK", config.ClusterName),
+		clusterName:     config.ClusterName,
 		isPipesParallel: config.PipesParallel,
+		pipesMap:        config.Pipes,
+		optionalPipes:   config.OptionalPipes,
+		dropRules:       config.DropRules,
+		transforms:      config.Transforms,
+		classifier:      config.Classifier,
+		routes:          config.Routes,
+		limiter:         config.Limiter,
+		enricher:        config.Enricher,
+		stopCh:          make(chan struct{}),
 	}, nil
 }
@@ -0,0 +1,75 @@
+package expressions
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	apiCoreV1 "k8s.io/api/core/v1"
+	apisMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	namespaceCacheTTL = 1 * time.Minute
+	// namespaceFailureTTL is much shorter, so that a namespace created after
+	// its events or a transient error is not missed for long.
+	namespaceFailureTTL = 5 * time.Second
+)
+
+// Enricher gets the data related to the events for evaluating the expressions.
+type Enricher interface {
+	// Namespace returns the namespace, or nil if it can't be got.
+	Namespace(name string) *apiCoreV1.Namespace
+}
+
+type namespaceEntry struct {
+	namespace *apiCoreV1.Namespace
+	expiresAt time.Time
+}
+
+// namespaceEnricher gets the namespaces on demand and caches them for a while,
+// the failures are cached shortly as well, so that a missing permission doesn't flood the API.
+// The lock is not held while getting, so that a slow API never blocks the lookups
+// of the cached namespaces.
+type namespaceEnricher struct {
+	logContext logrus.Fields
+
+	kclient kubernetes.Interface
+	entries map[string]namespaceEntry
+	sync.RWMutex
+}
+
+func (e *namespaceEnricher) Namespace(name string) *apiCoreV1.Namespace {
+	e.RLock()
+	entry, ok := e.entries[name]
+	e.RUnlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry.namespace
+	}
+
+	ttl := namespaceCacheTTL
+	namespace, err := e.kclient.CoreV1().Namespaces().Get(name, apisMetaV1.GetOptions{})
+	if err != nil {
+		logrus.WithFields(e.logContext).WithError(err).Debugf("can't get namespace %s for expressions", name)
+		namespace = nil
+		ttl = namespaceFailureTTL
+	}
+
+	e.Lock()
+	e.entries[name] = namespaceEntry{
+		namespace: namespace,
+		expiresAt: time.Now().Add(ttl),
+	}
+	e.Unlock()
+
+	return namespace
+}
+
+func NewNamespaceEnricher(logContext logrus.Fields, kclient kubernetes.Interface) Enricher {
+	return &namespaceEnricher{
+		logContext: logContext,
+		kclient:    kclient,
+		entries:    make(map[string]namespaceEntry),
+	}
+}
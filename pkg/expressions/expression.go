@@ -0,0 +1,150 @@
+package expressions
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+	"github.com/juju/errors"
+	apiCoreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	clusterVar = "cluster"
+	eventVar   = "event"
+	// not "namespace", which is a reserved identifier of CEL
+	namespaceVar = "ns"
+)
+
+var (
+	envOnce sync.Once
+	env     *cel.Env
+	envErr  error
+)
+
+func getEnv() (*cel.Env, error) {
+	envOnce.Do(func() {
+		env, envErr = cel.NewEnv(cel.Declarations(
+			decls.NewVar(clusterVar, decls.String),
+			decls.NewVar(eventVar, decls.NewMapType(decls.String, decls.Dyn)),
+			decls.NewVar(namespaceVar, decls.NewMapType(decls.String, decls.Dyn)),
+		))
+	})
+
+	return env, envErr
+}
+
+// Expression is a CEL expression returning a bool, which evaluates on the variables:
+//   - cluster: the name of the cluster;
+//   - event: the event in its json form, e.g. event.involvedObject.kind;
+//   - ns: the name, the labels and the annotations of the namespace of the
+//     involved object, which are blank if it is cluster scoped or can't be got.
+//
+// For example,
+//
+//	event.type == "Warning" && event.count > 5 && event.message.contains("OOMKilled") &&
+//	  !("tier" in ns.labels && ns.labels.tier == "dev")
+//
+// An expression is compiled on unmarshalling, so that the configuration is validated
+// on loading.
+type Expression struct {
+	source  string
+	program cel.Program
+}
+
+func (e *Expression) String() string {
+	return e.source
+}
+
+func (e *Expression) UnmarshalJSON(data []byte) error {
+	var source string
+	if err := json.Unmarshal(data, &source); err != nil {
+		return err
+	}
+
+	compiled, err := Compile(source)
+	if err != nil {
+		return err
+	}
+	*e = *compiled
+
+	return nil
+}
+
+func (e *Expression) MarshalJSON() ([]byte, error) {
+	return json.Marshal(e.source)
+}
+
+// Match evaluates the expression on the event, a nil expression matches anything.
+// The failed evaluation, e.g. accessing a missing key, doesn't match.
+func (e *Expression) Match(cluster string, event *apiCoreV1.Event, enricher Enricher) bool {
+	if e == nil {
+		return true
+	}
+
+	// the variables are lazily resolved, only the referred ones are converted or got
+	out, _, err := e.program.Eval(map[string]interface{}{
+		clusterVar: cluster,
+		eventVar: func() interface{} {
+			obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(event)
+			if err != nil {
+				return map[string]interface{}{}
+			}
+			return obj
+		},
+		namespaceVar: func() interface{} {
+			name := event.InvolvedObject.Namespace
+			labels, annotations := map[string]string{}, map[string]string{}
+			if enricher != nil && len(name) != 0 {
+				if namespace := enricher.Namespace(name); namespace != nil {
+					if namespace.Labels != nil {
+						labels = namespace.Labels
+					}
+					if namespace.Annotations != nil {
+						annotations = namespace.Annotations
+					}
+				}
+			}
+			return map[string]interface{}{
+				"name":        name,
+				"labels":      labels,
+				"annotations": annotations,
+			}
+		},
+	})
+	if err != nil {
+		return false
+	}
+
+	matched, ok := out.Value().(bool)
+	return ok && matched
+}
+
+// Compile compiles and checks the expression, which must return a bool.
+func Compile(source string) (*Expression, error) {
+	env, err := getEnv()
+	if err != nil {
+		return nil, errors.Annotate(err, "can't create CEL environment")
+	}
+
+	ast, issues := env.Compile(source)
+	if issues != nil && issues.Err() != nil {
+		return nil, errors.Annotatef(issues.Err(), "can't compile expression %q", source)
+	}
+	if !proto.Equal(ast.ResultType(), decls.Bool) {
+		return nil, errors.Errorf("expression %q must return bool", source)
+	}
+
+	program, err := env.Program(ast)
+	if err != nil {
+		return nil, errors.Annotatef(err, "can't create program of expression %q", source)
+	}
+
+	return &Expression{
+		source:  source,
+		program: program,
+	}, nil
+}
@@ -0,0 +1,195 @@
+package expressions
+
+import (
+	"encoding/json"
+	"testing"
+
+	apiCoreV1 "k8s.io/api/core/v1"
+	apisMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// testEnricher returns the namespaces with the labels, others can't be got.
+type testEnricher map[string]map[string]string
+
+func (e testEnricher) Namespace(name string) *apiCoreV1.Namespace {
+	nsLabels, ok := e[name]
+	if !ok {
+		return nil
+	}
+
+	return &apiCoreV1.Namespace{
+		ObjectMeta: apisMetaV1.ObjectMeta{
+			Name:   name,
+			Labels: nsLabels,
+		},
+	}
+}
+
+func newTestEvent(namespace string) *apiCoreV1.Event {
+	return &apiCoreV1.Event{
+		ObjectMeta: apisMetaV1.ObjectMeta{
+			Labels: map[string]string{"team": "a"},
+		},
+		InvolvedObject: apiCoreV1.ObjectReference{
+			Namespace: namespace,
+			Kind:      "Pod",
+			Name:      "nginx",
+		},
+		Reason:  "BackOff",
+		Type:    apiCoreV1.EventTypeWarning,
+		Message: "Back-off restarting failed container",
+		Count:   6,
+	}
+}
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		isErr  bool
+	}{
+		{name: "bool", source: `event.type == "Warning" && event.count > 5`},
+		{name: "namespace labels", source: `"tier" in ns.labels`},
+		{name: "cluster", source: `cluster.startsWith("prod")`},
+		{name: "string result", source: `event.message`, isErr: true},
+		{name: "int result", source: `1 + 2`, isErr: true},
+		{name: "syntax error", source: `event.type ==`, isErr: true},
+		{name: "unbalanced parenthesis", source: `(event.count > 5`, isErr: true},
+		{name: "undeclared variable", source: `pod.name == "nginx"`, isErr: true},
+		{name: "reserved identifier", source: `namespace.name == "default"`, isErr: true},
+		{name: "blank", source: ``, isErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Compile(tt.source)
+			if tt.isErr && err == nil {
+				t.Error("expected error but got nil")
+			}
+			if !tt.isErr && err != nil {
+				t.Errorf("expected no error but got %v", err)
+			}
+		})
+	}
+}
+
+func TestExpressionMatch(t *testing.T) {
+	enricher := testEnricher{
+		"payments": {"tier": "prod"},
+		"sandbox":  {"tier": "dev"},
+	}
+
+	tests := []struct {
+		name     string
+		source   string
+		cluster  string
+		event    *apiCoreV1.Event
+		expected bool
+	}{
+		{
+			name:     "event fields",
+			source:   `event.type == "Warning" && event.count > 5 && event.message.contains("Back-off")`,
+			event:    newTestEvent("payments"),
+			expected: true,
+		},
+		{
+			name:     "nested event fields",
+			source:   `event.involvedObject.kind == "Pod" && event.metadata.labels.team == "a"`,
+			event:    newTestEvent("payments"),
+			expected: true,
+		},
+		{
+			name:     "cluster",
+			source:   `cluster == "prod"`,
+			cluster:  "staging",
+			event:    newTestEvent("payments"),
+			expected: false,
+		},
+		{
+			name:     "missing key doesn't match",
+			source:   `event.metadata.labels.owner == "a"`,
+			event:    newTestEvent("payments"),
+			expected: false,
+		},
+		{
+			name:     "negated missing key doesn't match",
+			source:   `!(event.metadata.labels.owner == "a")`,
+			event:    newTestEvent("payments"),
+			expected: false,
+		},
+		{
+			name:     "missing key is checked by in",
+			source:   `!("owner" in event.metadata.labels)`,
+			event:    newTestEvent("payments"),
+			expected: true,
+		},
+		{
+			name:     "namespace labels",
+			source:   `ns.labels.tier == "prod"`,
+			event:    newTestEvent("payments"),
+			expected: true,
+		},
+		{
+			name:     "namespace name",
+			source:   `ns.name == "sandbox" && ns.labels.tier == "dev"`,
+			event:    newTestEvent("sandbox"),
+			expected: true,
+		},
+		{
+			name:     "namespace which can't be got has blank labels",
+			source:   `ns.name == "unknown" && size(ns.labels) == 0 && size(ns.annotations) == 0`,
+			event:    newTestEvent("unknown"),
+			expected: true,
+		},
+		{
+			name:     "cluster-scoped event has blank namespace",
+			source:   `ns.name == "" && !("tier" in ns.labels)`,
+			event:    newTestEvent(""),
+			expected: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := Compile(tt.source)
+			if err != nil {
+				t.Fatalf("can't compile: %v", err)
+			}
+
+			if actual := e.Match(tt.cluster, tt.event, enricher); actual != tt.expected {
+				t.Errorf("expected %v but got %v", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestExpressionMatchWithoutEnricher(t *testing.T) {
+	e, err := Compile(`ns.name == "payments" && size(ns.labels) == 0`)
+	if err != nil {
+		t.Fatalf("can't compile: %v", err)
+	}
+
+	if !e.Match("prod", newTestEvent("payments"), nil) {
+		t.Error("expected matched but got unmatched")
+	}
+
+	// a nil expression matches anything
+	var nilExpression *Expression
+	if !nilExpression.Match("prod", newTestEvent("payments"), nil) {
+		t.Error("expected nil expression matched but got unmatched")
+	}
+}
+
+func TestExpressionUnmarshalJSON(t *testing.T) {
+	var e Expression
+	if err := json.Unmarshal([]byte(`"event.count > 5"`), &e); err != nil {
+		t.Fatalf("can't unmarshal: %v", err)
+	}
+	if e.String() != "event.count > 5" {
+		t.Errorf("expected the source but got %s", e.String())
+	}
+
+	if err := json.Unmarshal([]byte(`"event.count"`), &e); err == nil {
+		t.Error("expected error of non-bool expression but got nil")
+	}
+}
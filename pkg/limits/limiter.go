@@ -0,0 +1,223 @@
+package limits
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/juju/errors"
+	apiCoreV1 "k8s.io/api/core/v1"
+	apisMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+const defaultSummaryPeriod = 1 * time.Minute
+
+// Config limits the events of each key, which is the namespace, the involved object
+// and the reason of an event, e.g.
+//
+//	qps: 0.2
+//	burst: 10
+//	sampleRate: 0.5
+//	summaryPeriod: 1m
+//
+// An event is sampled by the rate at first, then limited by a token bucket of the QPS
+// and the burst, a zero QPS means unlimited. The suppressed events of a key are summarized
+// by a record every summary period.
+type Config struct {
+	QPS           float32  `json:"qps,omitempty"`
+	Burst         int      `json:"burst,omitempty"`
+	SampleRate    *float64 `json:"sampleRate,omitempty"`
+	SummaryPeriod string   `json:"summaryPeriod,omitempty"`
+}
+
+func (c *Config) Validate() error {
+	if c == nil {
+		return nil
+	}
+
+	_, err := c.parse()
+	return err
+}
+
+func (c *Config) parse() (time.Duration, error) {
+	if c.QPS < 0 {
+		return 0, errors.New("qps must be non-negative")
+	}
+	if c.QPS > 0 && c.Burst <= 0 {
+		return 0, errors.New("burst must be positive with qps")
+	}
+	if c.SampleRate != nil && (*c.SampleRate <= 0 || *c.SampleRate > 1) {
+		return 0, errors.New("sampleRate must be in (0, 1]")
+	}
+
+	period := defaultSummaryPeriod
+	if len(c.SummaryPeriod) != 0 {
+		var err error
+		if period, err = time.ParseDuration(c.SummaryPeriod); err != nil {
+			return 0, errors.Annotate(err, "can't parse summaryPeriod")
+		}
+		if period <= 0 {
+			return 0, errors.New("summaryPeriod must be positive")
+		}
+	}
+
+	return period, nil
+}
+
+type keyState struct {
+	limiter flowcontrol.RateLimiter
+
+	suppressed      int32
+	firstSuppressed time.Time
+	lastSuppressed  *apiCoreV1.Event
+	lastSeen        time.Time
+}
+
+// Limiter suppresses the flooding events by key, it is safe for concurrent use.
+type Limiter struct {
+	qps        float32
+	burst      int
+	sampleRate float64
+	period     time.Duration
+
+	keys          map[string]*keyState
+	lastSummaryAt time.Time
+	suppressed    uint64
+	sync.Mutex
+}
+
+// Allow returns false if the event is suppressed, a nil limiter allows all.
+func (l *Limiter) Allow(event *apiCoreV1.Event) bool {
+	if l == nil {
+		return true
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	now := time.Now()
+	key := eventKey(event)
+	state, ok := l.keys[key]
+	if !ok {
+		state = &keyState{}
+		if l.qps > 0 {
+			state.limiter = flowcontrol.NewTokenBucketRateLimiter(l.qps, l.burst)
+		}
+		l.keys[key] = state
+	}
+	state.lastSeen = now
+
+	if (l.sampleRate >= 1 || rand.Float64() < l.sampleRate) &&
+		(state.limiter == nil || state.limiter.TryAccept()) {
+		return true
+	}
+
+	if state.suppressed == 0 {
+		state.firstSuppressed = now
+	}
+	state.suppressed++
+	state.lastSuppressed = event
+	atomic.AddUint64(&l.suppressed, 1)
+
+	return false
+}
+
+// Suppressed returns the total count of the suppressed events.
+func (l *Limiter) Suppressed() uint64 {
+	if l == nil {
+		return 0
+	}
+
+	return atomic.LoadUint64(&l.suppressed)
+}
+
+// Summarize returns the summary records of the keys which have suppressed events
+// since the last summary, once a summary period or when forced, e.g. on stopping.
+// The idle keys are forgotten after summarizing.
+func (l *Limiter) Summarize(force bool) []*apiCoreV1.Event {
+	if l == nil {
+		return nil
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	now := time.Now()
+	if !force && now.Sub(l.lastSummaryAt) < l.period {
+		return nil
+	}
+	l.lastSummaryAt = now
+
+	summaries := make([]*apiCoreV1.Event, 0)
+	for key, state := range l.keys {
+		if state.suppressed != 0 {
+			summaries = append(summaries, summaryEvent(state, now))
+			state.suppressed = 0
+			state.lastSuppressed = nil
+			continue
+		}
+
+		if now.Sub(state.lastSeen) >= l.period {
+			delete(l.keys, key)
+		}
+	}
+
+	return summaries
+}
+
+// summaryEvent is a new event of the last suppressed event, whose count is the
+// suppressed count, so that the pipes store it as other events.
+func summaryEvent(state *keyState, now time.Time) *apiCoreV1.Event {
+	last := state.lastSuppressed
+
+	summary := last.DeepCopy()
+	summary.ObjectMeta = apisMetaV1.ObjectMeta{
+		Name:              fmt.Sprintf("%s.suppressed.%x", last.InvolvedObject.Name, now.UnixNano()),
+		Namespace:         last.Namespace,
+		UID:               uuid.NewUUID(),
+		CreationTimestamp: apisMetaV1.NewTime(now),
+		Labels:            last.Labels,
+	}
+	summary.Message = fmt.Sprintf("%d similar events suppressed, the last one: %s", state.suppressed, last.Message)
+	summary.Count = state.suppressed
+	summary.FirstTimestamp = apisMetaV1.NewTime(state.firstSuppressed)
+	summary.LastTimestamp = apisMetaV1.NewTime(now)
+
+	return summary
+}
+
+func eventKey(event *apiCoreV1.Event) string {
+	involvedObject := event.InvolvedObject
+
+	return involvedObject.Namespace + "/" + involvedObject.Kind + "/" + involvedObject.Name + "/" + event.Reason
+}
+
+// NewLimiter creates the limiter, a nil config returns a nil limiter.
+func NewLimiter(config *Config) (*Limiter, error) {
+	if config == nil {
+		return nil, nil
+	}
+
+	period, err := config.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	sampleRate := 1.0
+	if config.SampleRate != nil {
+		sampleRate = *config.SampleRate
+	}
+
+	return &Limiter{
+		qps:           config.QPS,
+		burst:         config.Burst,
+		sampleRate:    sampleRate,
+		period:        period,
+		keys:          make(map[string]*keyState),
+		lastSummaryAt: time.Now(),
+	}, nil
+}
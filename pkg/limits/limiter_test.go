@@ -0,0 +1,202 @@
+package limits
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	apiCoreV1 "k8s.io/api/core/v1"
+	apisMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newTestEvent(name, reason, message string) *apiCoreV1.Event {
+	return &apiCoreV1.Event{
+		ObjectMeta: apisMetaV1.ObjectMeta{
+			Namespace: "default",
+			Labels:    map[string]string{"team": "a"},
+		},
+		InvolvedObject: apiCoreV1.ObjectReference{
+			Namespace: "default",
+			Kind:      "Pod",
+			Name:      name,
+		},
+		Reason:  reason,
+		Message: message,
+	}
+}
+
+func float64Ptr(f float64) *float64 {
+	return &f
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *Config
+		isErr  bool
+	}{
+		{name: "nil"},
+		{name: "blank", config: &Config{}},
+		{name: "qps with burst", config: &Config{QPS: 0.2, Burst: 10, SampleRate: float64Ptr(0.5), SummaryPeriod: "30s"}},
+		{name: "negative qps", config: &Config{QPS: -1, Burst: 1}, isErr: true},
+		{name: "qps without burst", config: &Config{QPS: 1}, isErr: true},
+		{name: "zero sample rate", config: &Config{SampleRate: float64Ptr(0)}, isErr: true},
+		{name: "sample rate above one", config: &Config{SampleRate: float64Ptr(1.5)}, isErr: true},
+		{name: "broken summary period", config: &Config{SummaryPeriod: "1 minute"}, isErr: true},
+		{name: "negative summary period", config: &Config{SummaryPeriod: "-1m"}, isErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if tt.isErr && err == nil {
+				t.Error("expected error but got nil")
+			}
+			if !tt.isErr && err != nil {
+				t.Errorf("expected no error but got %v", err)
+			}
+		})
+	}
+}
+
+func TestLimiterAllow(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   *Config
+		events   []*apiCoreV1.Event
+		expected []bool
+	}{
+		{
+			name:     "nil config allows all",
+			events:   []*apiCoreV1.Event{newTestEvent("a", "BackOff", ""), newTestEvent("a", "BackOff", "")},
+			expected: []bool{true, true},
+		},
+		{
+			name:   "burst of a key",
+			config: &Config{QPS: 0.001, Burst: 2},
+			events: []*apiCoreV1.Event{
+				newTestEvent("a", "BackOff", ""),
+				newTestEvent("a", "BackOff", ""),
+				newTestEvent("a", "BackOff", ""),
+			},
+			expected: []bool{true, true, false},
+		},
+		{
+			name:   "keys are limited apart",
+			config: &Config{QPS: 0.001, Burst: 1},
+			events: []*apiCoreV1.Event{
+				newTestEvent("a", "BackOff", ""),
+				newTestEvent("a", "BackOff", ""),
+				newTestEvent("b", "BackOff", ""),
+				newTestEvent("a", "Unhealthy", ""),
+			},
+			expected: []bool{true, false, true, true},
+		},
+		{
+			name:   "zero qps is unlimited",
+			config: &Config{},
+			events: []*apiCoreV1.Event{
+				newTestEvent("a", "BackOff", ""),
+				newTestEvent("a", "BackOff", ""),
+				newTestEvent("a", "BackOff", ""),
+			},
+			expected: []bool{true, true, true},
+		},
+		{
+			name:   "full sample rate samples all",
+			config: &Config{SampleRate: float64Ptr(1)},
+			events: []*apiCoreV1.Event{
+				newTestEvent("a", "BackOff", ""),
+				newTestEvent("a", "BackOff", ""),
+			},
+			expected: []bool{true, true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter, err := NewLimiter(tt.config)
+			if err != nil {
+				t.Fatalf("can't create limiter: %v", err)
+			}
+
+			suppressed := uint64(0)
+			for i, event := range tt.events {
+				actual := limiter.Allow(event)
+				if actual != tt.expected[i] {
+					t.Errorf("event #%d: expected %v but got %v", i, tt.expected[i], actual)
+				}
+				if !actual {
+					suppressed++
+				}
+			}
+			if limiter.Suppressed() != suppressed {
+				t.Errorf("expected %d suppressed but got %d", suppressed, limiter.Suppressed())
+			}
+		})
+	}
+}
+
+func TestLimiterSampleRate(t *testing.T) {
+	limiter, err := NewLimiter(&Config{SampleRate: float64Ptr(0.5)})
+	if err != nil {
+		t.Fatalf("can't create limiter: %v", err)
+	}
+
+	allowed := 0
+	for i := 0; i < 1000; i++ {
+		if limiter.Allow(newTestEvent("a", "BackOff", "")) {
+			allowed++
+		}
+	}
+	if allowed < 350 || allowed > 650 {
+		t.Errorf("expected about half allowed but got %d of 1000", allowed)
+	}
+}
+
+func TestLimiterSummarize(t *testing.T) {
+	limiter, err := NewLimiter(&Config{QPS: 0.001, Burst: 1, SummaryPeriod: "50ms"})
+	if err != nil {
+		t.Fatalf("can't create limiter: %v", err)
+	}
+
+	limiter.Allow(newTestEvent("a", "BackOff", "first"))
+	limiter.Allow(newTestEvent("a", "BackOff", "second"))
+	limiter.Allow(newTestEvent("a", "BackOff", "third"))
+	limiter.Allow(newTestEvent("b", "BackOff", "other"))
+
+	if summaries := limiter.Summarize(false); len(summaries) != 0 {
+		t.Fatalf("expected no summary within the period but got %d", len(summaries))
+	}
+
+	summaries := limiter.Summarize(true)
+	if len(summaries) != 1 {
+		t.Fatalf("expected 1 summary but got %d", len(summaries))
+	}
+	summary := summaries[0]
+	if summary.Count != 2 {
+		t.Errorf("expected count 2 but got %d", summary.Count)
+	}
+	if expected := "2 similar events suppressed, the last one: third"; summary.Message != expected {
+		t.Errorf("expected message %q but got %q", expected, summary.Message)
+	}
+	if !strings.HasPrefix(summary.Name, "a.suppressed.") || len(summary.UID) == 0 {
+		t.Errorf("expected a new event of a but got %s of %s", summary.Name, summary.UID)
+	}
+	if summary.Labels["team"] != "a" || summary.InvolvedObject.Name != "a" || summary.Reason != "BackOff" {
+		t.Errorf("expected the summary keeps the labels, the involved object and the reason, but got %+v", summary)
+	}
+	if summary.FirstTimestamp.IsZero() || summary.LastTimestamp.Before(&summary.FirstTimestamp) {
+		t.Errorf("expected the summary spans the suppression, but got %s - %s", summary.FirstTimestamp, summary.LastTimestamp)
+	}
+
+	// the suppression is summarized once, and the idle keys are forgotten after the period
+	if summaries := limiter.Summarize(true); len(summaries) != 0 {
+		t.Errorf("expected no summary after summarizing but got %d", len(summaries))
+	}
+	time.Sleep(60 * time.Millisecond)
+	limiter.Summarize(true)
+	if !limiter.Allow(newTestEvent("a", "BackOff", "again")) {
+		t.Error("expected the forgotten key to be allowed")
+	}
+}
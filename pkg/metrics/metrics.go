@@ -0,0 +1,38 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/classify"
+	apiCoreV1 "k8s.io/api/core/v1"
+)
+
+const namespace = "kubernetes_event_exporter"
+
+var (
+	eventsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_total",
+		Help:      "Count of the added or updated events reaching the pipes.",
+	}, []string{"cluster", "type", "severity", "category"})
+
+	suppressedEventsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "suppressed_events_total",
+		Help:      "Count of the events suppressed by the limits.",
+	}, []string{"cluster", "severity", "category"})
+)
+
+func init() {
+	prometheus.MustRegister(eventsTotal, suppressedEventsTotal)
+}
+
+// ObserveEvent counts the event by its classification labels,
+// which are blank if the classification is disabled.
+func ObserveEvent(cluster string, event *apiCoreV1.Event) {
+	eventsTotal.WithLabelValues(cluster, event.Type, event.Labels[classify.SeverityLabel], event.Labels[classify.CategoryLabel]).Inc()
+}
+
+// ObserveSuppressed counts the suppressed event by its classification labels.
+func ObserveSuppressed(cluster string, event *apiCoreV1.Event) {
+	suppressedEventsTotal.WithLabelValues(cluster, event.Labels[classify.SeverityLabel], event.Labels[classify.CategoryLabel]).Inc()
+}
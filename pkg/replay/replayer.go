@@ -0,0 +1,104 @@
+package replay
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/streams"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/utils/logger"
+	apiCoreV1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+// ReplayerConfig represents the configuration of the replayer, the zero times
+// leave the range open, and the zero QPS leaves the replay unlimited.
+type ReplayerConfig struct {
+	Cluster string
+	Source  Source
+	Since   time.Time
+	Until   time.Time
+	QPS     float32
+	Burst   int
+	// Handle receives the events in range, e.g. the Add of the sink, the error counts
+	// the event as failed rather than stopping the replay.
+	Handle func(event *apiCoreV1.Event) error
+}
+
+// Stats counts the read events, the skipped ones are out of the time range,
+// and the failed ones are replayed but not handled by some pipes.
+type Stats struct {
+	Read     int
+	Skipped  int
+	Replayed int
+	Failed   int
+}
+
+// Replayer feeds the archived events in the time range at the limited rate.
+type Replayer struct {
+	logContext logrus.Fields
+
+	config      *ReplayerConfig
+	rateLimiter flowcontrol.RateLimiter
+}
+
+func (r *Replayer) Run(ctx context.Context) (*Stats, error) {
+	stats := &Stats{}
+	logrus.WithFields(r.logContext).Infoln("replaying")
+
+	err := r.config.Source.Read(ctx, func(event *apiCoreV1.Event) error {
+		stats.Read++
+		if !r.inRange(event) {
+			stats.Skipped++
+			return nil
+		}
+
+		if r.rateLimiter != nil {
+			r.rateLimiter.Accept()
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := r.config.Handle(event); err != nil {
+			logrus.WithFields(r.logContext).WithError(err).Warnln("failed to replay event")
+			stats.Failed++
+		}
+		stats.Replayed++
+		if stats.Replayed%1000 == 0 {
+			logrus.WithFields(r.logContext).Infof("replayed %d events", stats.Replayed)
+		}
+		return nil
+	})
+
+	return stats, err
+}
+
+func (r *Replayer) inRange(event *apiCoreV1.Event) bool {
+	t := streams.LastSeen(event)
+	if !r.config.Since.IsZero() && t.Before(r.config.Since) {
+		return false
+	}
+	if !r.config.Until.IsZero() && !t.Before(r.config.Until) {
+		return false
+	}
+
+	return true
+}
+
+func NewReplayer(config *ReplayerConfig) *Replayer {
+	r := &Replayer{
+		logContext: logger.CreateLogContext("REPLAYER", config.Cluster),
+
+		config: config,
+	}
+	if config.QPS > 0 {
+		burst := config.Burst
+		if burst < 1 {
+			burst = 1
+		}
+		r.rateLimiter = flowcontrol.NewTokenBucketRateLimiter(config.QPS, burst)
+	}
+
+	return r
+}
@@ -0,0 +1,153 @@
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/juju/errors"
+	apiCoreV1 "k8s.io/api/core/v1"
+)
+
+// Source reads the archived events in order, the reading stops at the first error
+// returned by the handler.
+type Source interface {
+	Read(ctx context.Context, handle func(event *apiCoreV1.Event) error) error
+}
+
+// fileSource reads the NDJSON files, e.g. written by a pipe with the json encoding,
+// a directory is read file by file in the order of the names.
+type fileSource struct {
+	path string
+}
+
+func (s *fileSource) Read(ctx context.Context, handle func(event *apiCoreV1.Event) error) error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return errors.Annotatef(err, "can't stat %s", s.path)
+	}
+
+	paths := []string{s.path}
+	if info.IsDir() {
+		entries, err := filepath.Glob(filepath.Join(s.path, "*"))
+		if err != nil {
+			return errors.Annotatef(err, "can't list %s", s.path)
+		}
+		sort.Strings(entries)
+
+		paths = paths[:0]
+		for _, entry := range entries {
+			if entryInfo, err := os.Stat(entry); err == nil && entryInfo.Mode().IsRegular() {
+				paths = append(paths, entry)
+			}
+		}
+	}
+
+	for _, path := range paths {
+		if err := s.readFile(ctx, path, handle); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *fileSource) readFile(ctx context.Context, path string, handle func(event *apiCoreV1.Event) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Annotatef(err, "can't open %s", path)
+	}
+	defer f.Close()
+
+	return errors.Annotatef(readNDJSON(ctx, f, handle), "can't read %s", path)
+}
+
+// NewFileSource reads the NDJSON file or the NDJSON files of the directory,
+// the gzip compressed files are decompressed.
+func NewFileSource(path string) Source {
+	return &fileSource{path: path}
+}
+
+// httpSource reads a single NDJSON object by GET, e.g. the pre-signed URL of an archived object.
+// It doesn't list the objects of a bucket or a prefix, which must be downloaded into a directory
+// and read by the file source instead.
+type httpSource struct {
+	url    string
+	client *http.Client
+}
+
+func (s *httpSource) Read(ctx context.Context, handle func(event *apiCoreV1.Event) error) error {
+	req, err := http.NewRequest(http.MethodGet, s.url, nil)
+	if err != nil {
+		return errors.Annotatef(err, "can't create request of %s", s.url)
+	}
+
+	resp, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Annotatef(err, "can't get %s", s.url)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return errors.Errorf("can't get %s, got status %s", s.url, resp.Status)
+	}
+
+	return errors.Annotatef(readNDJSON(ctx, resp.Body, handle), "can't read %s", s.url)
+}
+
+func NewHTTPSource(url string) Source {
+	return &httpSource{
+		url:    url,
+		client: &http.Client{},
+	}
+}
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// readNDJSON decodes an event from each line, the blank lines are skipped.
+func readNDJSON(ctx context.Context, r io.Reader, handle func(event *apiCoreV1.Event) error) error {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(len(gzipMagic)); bytes.Equal(magic, gzipMagic) {
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return errors.Annotate(err, "can't decompress")
+		}
+		defer gr.Close()
+		br = bufio.NewReader(gr)
+	}
+
+	for lineNo := 1; ; lineNo++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		line, err := br.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return errors.Annotatef(err, "can't read line %d", lineNo)
+		}
+
+		if line = bytes.TrimSpace(line); len(line) != 0 {
+			event := &apiCoreV1.Event{}
+			if jsonErr := json.Unmarshal(line, event); jsonErr != nil {
+				return errors.Annotatef(jsonErr, "can't decode line %d", lineNo)
+			}
+			if len(event.Kind) != 0 && event.Kind != "Event" {
+				return errors.Errorf("can't decode line %d, got kind %s", lineNo, event.Kind)
+			}
+			if handleErr := handle(event); handleErr != nil {
+				return handleErr
+			}
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
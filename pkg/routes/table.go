@@ -0,0 +1,360 @@
+package routes
+
+import (
+	"path"
+
+	"github.com/juju/errors"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/expressions"
+	apiCoreV1 "k8s.io/api/core/v1"
+)
+
+// Config represents the routing table of the pipes, e.g.
+//
+//	rules:
+//	- match: {namespaces: [kube-system]}
+//	  pipes: []
+//	- match: {types: [Warning], namespaces: ["prod-*"]}
+//	  pipes: [pagerduty]
+//	  continue: true
+//	default: [s3]
+//
+// The rules are evaluated in order, an event is sent to the pipes of all matched rules,
+// the evaluation stops at the first matched rule without continue. The default route
+// takes the events which reach the end of the rules, a missing default means all pipes,
+// and a blank default means none.
+type Config struct {
+	Rules   []*Rule  `json:"rules,omitempty"`
+	Default []string `json:"default,omitempty"`
+}
+
+type Rule struct {
+	Match    *Match   `json:"match,omitempty"`
+	Pipes    []string `json:"pipes"`
+	Continue bool     `json:"continue,omitempty"`
+}
+
+// Match selects the events by the glob patterns, e.g. "prod-*", a blank field matches
+// anything. The labels are the labels of the event, which may be set by the transforms.
+// The expression is a CEL expression, see expressions.Expression.
+type Match struct {
+	Clusters   []string          `json:"clusters,omitempty"`
+	Namespaces []string          `json:"namespaces,omitempty"`
+	Kinds      []string          `json:"kinds,omitempty"`
+	Types      []string          `json:"types,omitempty"`
+	Reasons    []string          `json:"reasons,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+
+	Expression *expressions.Expression `json:"expression,omitempty"`
+}
+
+func (m *Match) Matches(cluster string, event *apiCoreV1.Event, enricher expressions.Enricher) bool {
+	if m == nil {
+		return true
+	}
+
+	involvedObject := event.InvolvedObject
+	if !matchAny(m.Clusters, cluster) ||
+		!matchAny(m.Namespaces, involvedObject.Namespace) ||
+		!matchAny(m.Kinds, involvedObject.Kind) ||
+		!matchAny(m.Types, event.Type) ||
+		!matchAny(m.Reasons, event.Reason) {
+		return false
+	}
+
+	for key, pattern := range m.Labels {
+		value, ok := event.Labels[key]
+		if !ok || !matchGlob(pattern, value) {
+			return false
+		}
+	}
+
+	return m.Expression.Match(cluster, event, enricher)
+}
+
+func (m *Match) validate() error {
+	if m == nil {
+		return nil
+	}
+
+	patterns := make([]string, 0)
+	for _, field := range [][]string{m.Clusters, m.Namespaces, m.Kinds, m.Types, m.Reasons} {
+		patterns = append(patterns, field...)
+	}
+	for _, pattern := range m.Labels {
+		patterns = append(patterns, pattern)
+	}
+
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return errors.Annotatef(err, "invalid pattern %s", pattern)
+		}
+	}
+
+	return nil
+}
+
+// Validate checks the patterns of the rules, the pipes are checked on creating the table.
+func (c *Config) Validate() error {
+	if c == nil {
+		return nil
+	}
+
+	for i, rule := range c.Rules {
+		if rule == nil {
+			return errors.Errorf("blank route #%d", i)
+		}
+		if err := rule.Match.validate(); err != nil {
+			return errors.Annotatef(err, "invalid route #%d", i)
+		}
+	}
+
+	return nil
+}
+
+// Scope represents the rules and the pipes owned by a namespace of a cluster, e.g. declared
+// by the EventRoute and EventExporterPipe resources. The rules only select the events of
+// the namespace and can only target the pipes of the scope, which in turn only receive
+// the events routed to them explicitly.
+type Scope struct {
+	Cluster   string
+	Namespace string
+	Rules     []*Rule
+	Pipes     []string
+}
+
+func (s *Scope) validate() error {
+	if len(s.Cluster) == 0 || len(s.Namespace) == 0 {
+		return errors.New("scope requires cluster and namespace")
+	}
+
+	owned := make(map[string]struct{}, len(s.Pipes))
+	for _, name := range s.Pipes {
+		owned[name] = struct{}{}
+	}
+
+	for i, rule := range s.Rules {
+		if rule == nil {
+			return errors.Errorf("blank route #%d", i)
+		}
+		if err := rule.Match.validate(); err != nil {
+			return errors.Annotatef(err, "invalid route #%d", i)
+		}
+		for _, name := range rule.Pipes {
+			if _, ok := owned[name]; !ok {
+				return errors.Errorf("invalid route #%d, pipe %s is out of the scope", i, name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// scopedRules confines the rules to the scope, the evaluation always continues,
+// so that a scope can't take the events away from the other rules.
+func (s *Scope) scopedRules() []*Rule {
+	rules := make([]*Rule, 0, len(s.Rules))
+	for _, rule := range s.Rules {
+		match := &Match{}
+		if rule.Match != nil {
+			*match = *rule.Match
+		}
+		match.Clusters = []string{s.Cluster}
+		match.Namespaces = []string{s.Namespace}
+
+		rules = append(rules, &Rule{
+			Match:    match,
+			Pipes:    rule.Pipes,
+			Continue: true,
+		})
+	}
+
+	return rules
+}
+
+// Table routes the events to the pipes by name, it is safe for concurrent use.
+type Table struct {
+	rules        []*Rule
+	defaultPipes []string
+	defaultAll   bool
+	passthrough  []string
+
+	tenants []*Tenant
+	owners  map[string]*Tenant
+}
+
+// Route returns the names of the pipes which the event goes to,
+// nil means all pipes.
+func (t *Table) Route(cluster string, event *apiCoreV1.Event, enricher expressions.Enricher) map[string]struct{} {
+	if t == nil {
+		return nil
+	}
+
+	targets := t.route(cluster, event, enricher)
+	if len(t.tenants) == 0 {
+		return targets
+	}
+
+	// the pipes of the tenants are never left to the rules, the default route has been
+	// expanded, so the targets aren't nil
+	for name := range t.owners {
+		delete(targets, name)
+	}
+	for _, tenant := range t.tenants {
+		if !tenant.owns(cluster, event, enricher) {
+			continue
+		}
+		if tenant.Match.Matches(cluster, event, enricher) {
+			for _, name := range tenant.Pipes {
+				targets[name] = struct{}{}
+			}
+		}
+		break
+	}
+
+	return targets
+}
+
+func (t *Table) route(cluster string, event *apiCoreV1.Event, enricher expressions.Enricher) map[string]struct{} {
+	targets := make(map[string]struct{})
+	for _, name := range t.passthrough {
+		targets[name] = struct{}{}
+	}
+
+	for _, rule := range t.rules {
+		if !rule.Match.Matches(cluster, event, enricher) {
+			continue
+		}
+
+		for _, name := range rule.Pipes {
+			targets[name] = struct{}{}
+		}
+		if !rule.Continue {
+			return targets
+		}
+	}
+
+	if t.defaultAll {
+		return nil
+	}
+	for _, name := range t.defaultPipes {
+		targets[name] = struct{}{}
+	}
+
+	return targets
+}
+
+// NewTable creates the table of the pipes, the passthrough pipes receive all events
+// regardless of the rules, the rules of the scopes are evaluated before the others, and
+// the tenants isolate their pipes. A nil config without any tenants and scopes returns
+// a nil table, which routes to all pipes.
+func NewTable(config *Config, tenants []*Tenant, scopes []*Scope, pipeNames []string, passthrough ...string) (*Table, error) {
+	if config == nil {
+		if len(tenants) == 0 && len(scopes) == 0 {
+			return nil, nil
+		}
+		config = &Config{}
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	if err := ValidateTenants(tenants); err != nil {
+		return nil, err
+	}
+
+	known := make(map[string]struct{}, len(pipeNames))
+	for _, name := range pipeNames {
+		known[name] = struct{}{}
+	}
+
+	owners := make(map[string]*Tenant)
+	for _, tenant := range tenants {
+		for _, name := range tenant.Pipes {
+			if _, ok := known[name]; !ok {
+				return nil, errors.Annotatef(errors.NotFoundf("pipe %s", name), "invalid tenant %s", tenant.Name)
+			}
+			owners[name] = tenant
+		}
+	}
+
+	var rules []*Rule
+	scoped := make(map[string]struct{})
+	for _, scope := range scopes {
+		if err := scope.validate(); err != nil {
+			return nil, errors.Annotatef(err, "invalid scope %s/%s", scope.Cluster, scope.Namespace)
+		}
+		for _, name := range scope.Pipes {
+			if _, ok := known[name]; !ok {
+				return nil, errors.Annotatef(errors.NotFoundf("pipe %s", name), "invalid scope %s/%s", scope.Cluster, scope.Namespace)
+			}
+			if tenant, ok := owners[name]; ok {
+				return nil, errors.Errorf("invalid scope %s/%s, pipe %s is owned by tenant %s", scope.Cluster, scope.Namespace, name, tenant.Name)
+			}
+			scoped[name] = struct{}{}
+		}
+		rules = append(rules, scope.scopedRules()...)
+	}
+	checkPipes := func(names []string) error {
+		for _, name := range names {
+			if _, ok := known[name]; !ok {
+				return errors.NotFoundf("pipe %s", name)
+			}
+			if tenant, ok := owners[name]; ok {
+				return errors.Errorf("pipe %s is owned by tenant %s", name, tenant.Name)
+			}
+		}
+		return nil
+	}
+
+	for i, rule := range config.Rules {
+		if err := checkPipes(rule.Pipes); err != nil {
+			return nil, errors.Annotatef(err, "invalid route #%d", i)
+		}
+	}
+	if err := checkPipes(config.Default); err != nil {
+		return nil, errors.Annotate(err, "invalid default route")
+	}
+
+	t := &Table{
+		rules:        append(rules, config.Rules...),
+		defaultPipes: config.Default,
+		defaultAll:   config.Default == nil,
+		passthrough:  passthrough,
+
+		tenants: tenants,
+		owners:  owners,
+	}
+
+	// the scoped pipes and the pipes of the tenants are left out of all pipes
+	if t.defaultAll && (len(scoped) != 0 || len(owners) != 0) {
+		t.defaultAll = false
+		t.defaultPipes = make([]string, 0, len(pipeNames))
+		for _, name := range pipeNames {
+			_, isScoped := scoped[name]
+			_, isOwned := owners[name]
+			if !isScoped && !isOwned {
+				t.defaultPipes = append(t.defaultPipes, name)
+			}
+		}
+	}
+
+	return t, nil
+}
+
+func matchAny(patterns []string, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+
+	for _, pattern := range patterns {
+		if matchGlob(pattern, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchGlob(pattern, value string) bool {
+	matched, _ := path.Match(pattern, value)
+	return matched
+}
@@ -0,0 +1,256 @@
+package routes
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	apiCoreV1 "k8s.io/api/core/v1"
+)
+
+func newTestEvent(namespace, kind, eventType, reason string) *apiCoreV1.Event {
+	return &apiCoreV1.Event{
+		InvolvedObject: apiCoreV1.ObjectReference{
+			Namespace: namespace,
+			Kind:      kind,
+			Name:      "test",
+		},
+		Type:   eventType,
+		Reason: reason,
+	}
+}
+
+// routedNames sorts the routed names, nil stands for all pipes.
+func routedNames(targets map[string]struct{}) []string {
+	if targets == nil {
+		return nil
+	}
+
+	names := make([]string, 0, len(targets))
+	for name := range targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func TestTableRoute(t *testing.T) {
+	pipeNames := []string{"s3", "pagerduty", "slack", "audit", "team-a"}
+
+	tests := []struct {
+		name        string
+		config      *Config
+		scopes      []*Scope
+		passthrough []string
+		cluster     string
+		event       *apiCoreV1.Event
+		expected    []string
+	}{
+		{
+			name:     "nil config routes to all pipes",
+			event:    newTestEvent("default", "Pod", "Normal", "Started"),
+			expected: nil,
+		},
+		{
+			name: "first matched rule stops the evaluation",
+			config: &Config{
+				Rules: []*Rule{
+					{Match: &Match{Types: []string{"Warning"}}, Pipes: []string{"pagerduty"}},
+					{Match: &Match{Kinds: []string{"Pod"}}, Pipes: []string{"slack"}},
+				},
+				Default: []string{"s3"},
+			},
+			event:    newTestEvent("default", "Pod", "Warning", "BackOff"),
+			expected: []string{"pagerduty"},
+		},
+		{
+			name: "continue collects the following rules",
+			config: &Config{
+				Rules: []*Rule{
+					{Match: &Match{Types: []string{"Warning"}}, Pipes: []string{"pagerduty"}, Continue: true},
+					{Match: &Match{Kinds: []string{"Pod"}}, Pipes: []string{"slack"}},
+					{Pipes: []string{"audit"}},
+				},
+				Default: []string{"s3"},
+			},
+			event:    newTestEvent("default", "Pod", "Warning", "BackOff"),
+			expected: []string{"pagerduty", "slack"},
+		},
+		{
+			name: "continue on the last rule reaches the default",
+			config: &Config{
+				Rules: []*Rule{
+					{Match: &Match{Types: []string{"Warning"}}, Pipes: []string{"pagerduty"}, Continue: true},
+				},
+				Default: []string{"s3"},
+			},
+			event:    newTestEvent("default", "Pod", "Warning", "BackOff"),
+			expected: []string{"pagerduty", "s3"},
+		},
+		{
+			name: "unmatched event goes to the default",
+			config: &Config{
+				Rules: []*Rule{
+					{Match: &Match{Namespaces: []string{"prod-*"}}, Pipes: []string{"pagerduty"}},
+				},
+				Default: []string{"s3"},
+			},
+			event:    newTestEvent("default", "Pod", "Warning", "BackOff"),
+			expected: []string{"s3"},
+		},
+		{
+			name: "missing default means all pipes",
+			config: &Config{
+				Rules: []*Rule{
+					{Match: &Match{Namespaces: []string{"prod-*"}}, Pipes: []string{"pagerduty"}},
+				},
+			},
+			event:    newTestEvent("default", "Pod", "Warning", "BackOff"),
+			expected: nil,
+		},
+		{
+			name: "blank default means none",
+			config: &Config{
+				Rules: []*Rule{
+					{Match: &Match{Namespaces: []string{"prod-*"}}, Pipes: []string{"pagerduty"}},
+				},
+				Default: []string{},
+			},
+			event:    newTestEvent("default", "Pod", "Warning", "BackOff"),
+			expected: []string{},
+		},
+		{
+			name: "rule without pipes drops the event",
+			config: &Config{
+				Rules: []*Rule{
+					{Match: &Match{Namespaces: []string{"kube-system"}}, Pipes: []string{}},
+				},
+				Default: []string{"s3"},
+			},
+			event:    newTestEvent("kube-system", "Pod", "Normal", "Pulled"),
+			expected: []string{},
+		},
+		{
+			name: "passthrough pipes receive all events",
+			config: &Config{
+				Rules: []*Rule{
+					{Match: &Match{Namespaces: []string{"kube-system"}}, Pipes: []string{}},
+				},
+				Default: []string{"s3"},
+			},
+			passthrough: []string{"audit"},
+			event:       newTestEvent("kube-system", "Pod", "Normal", "Pulled"),
+			expected:    []string{"audit"},
+		},
+		{
+			name: "match on cluster and labels",
+			config: &Config{
+				Rules: []*Rule{
+					{Match: &Match{Clusters: []string{"prod"}, Labels: map[string]string{"team": "a*"}}, Pipes: []string{"slack"}},
+				},
+				Default: []string{"s3"},
+			},
+			cluster: "prod",
+			event: func() *apiCoreV1.Event {
+				event := newTestEvent("default", "Pod", "Normal", "Started")
+				event.Labels = map[string]string{"team": "alpha"}
+				return event
+			}(),
+			expected: []string{"slack"},
+		},
+		{
+			name: "scoped rules continue and are confined to the scope",
+			config: &Config{
+				Rules: []*Rule{
+					{Match: &Match{Types: []string{"Warning"}}, Pipes: []string{"pagerduty"}},
+				},
+			},
+			scopes: []*Scope{
+				{
+					Cluster:   "prod",
+					Namespace: "team-a",
+					Rules:     []*Rule{{Pipes: []string{"team-a"}}},
+					Pipes:     []string{"team-a"},
+				},
+			},
+			cluster:  "prod",
+			event:    newTestEvent("team-a", "Pod", "Warning", "BackOff"),
+			expected: []string{"pagerduty", "team-a"},
+		},
+		{
+			name: "scoped pipes are left out of the default",
+			config: &Config{
+				Rules: []*Rule{
+					{Match: &Match{Types: []string{"Warning"}}, Pipes: []string{"pagerduty"}},
+				},
+			},
+			scopes: []*Scope{
+				{
+					Cluster:   "prod",
+					Namespace: "team-a",
+					Rules:     []*Rule{{Pipes: []string{"team-a"}}},
+					Pipes:     []string{"team-a"},
+				},
+			},
+			cluster:  "prod",
+			event:    newTestEvent("default", "Pod", "Normal", "Started"),
+			expected: []string{"audit", "pagerduty", "s3", "slack"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table, err := NewTable(tt.config, nil, tt.scopes, pipeNames, tt.passthrough...)
+			if err != nil {
+				t.Fatalf("can't create table: %v", err)
+			}
+
+			actual := routedNames(table.Route(tt.cluster, tt.event, nil))
+			if !reflect.DeepEqual(actual, tt.expected) {
+				t.Errorf("expected %v but got %v", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestNewTableValidates(t *testing.T) {
+	pipeNames := []string{"s3", "team-a"}
+
+	tests := []struct {
+		name   string
+		config *Config
+		scopes []*Scope
+	}{
+		{
+			name:   "unknown pipe of rule",
+			config: &Config{Rules: []*Rule{{Pipes: []string{"kafka"}}}},
+		},
+		{
+			name:   "unknown pipe of default",
+			config: &Config{Default: []string{"kafka"}},
+		},
+		{
+			name:   "invalid pattern",
+			config: &Config{Rules: []*Rule{{Match: &Match{Namespaces: []string{"["}}, Pipes: []string{"s3"}}}},
+		},
+		{
+			name:   "blank rule",
+			config: &Config{Rules: []*Rule{nil}},
+		},
+		{
+			name: "scoped rule out of the scope",
+			scopes: []*Scope{
+				{Cluster: "prod", Namespace: "team-a", Rules: []*Rule{{Pipes: []string{"s3"}}}, Pipes: []string{"team-a"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewTable(tt.config, nil, tt.scopes, pipeNames); err == nil {
+				t.Error("expected error but got nil")
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package routes
+
+import (
+	"github.com/juju/errors"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/expressions"
+	apiCoreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Tenant owns the events of its namespaces and a set of pipes, e.g.
+//
+//	tenants:
+//	- name: team-a
+//	  namespaces: ["team-a-*"]
+//	  namespaceSelector: "tenant=team-a"
+//	  match: {types: [Warning]}
+//	  pipes: [team-a-webhook]
+//
+// A namespace belongs to the tenant if it matches any of the glob patterns or the label
+// selector, and the clusters restrict the tenant to the matched clusters. The pipes of a
+// tenant receive all events of the tenant which pass the match, and nothing else, so the
+// routes can't target them. The tenants are evaluated in order, a namespace belongs to the
+// first matched tenant only. The events of the tenants still go to the shared pipes by the
+// routes.
+type Tenant struct {
+	Name              string   `json:"name"`
+	Clusters          []string `json:"clusters,omitempty"`
+	Namespaces        []string `json:"namespaces,omitempty"`
+	NamespaceSelector string   `json:"namespaceSelector,omitempty"`
+	Match             *Match   `json:"match,omitempty"`
+	Pipes             []string `json:"pipes"`
+
+	selector labels.Selector
+}
+
+func (t *Tenant) owns(cluster string, event *apiCoreV1.Event, enricher expressions.Enricher) bool {
+	namespace := event.InvolvedObject.Namespace
+	if len(namespace) == 0 || !matchAny(t.Clusters, cluster) {
+		return false
+	}
+
+	for _, pattern := range t.Namespaces {
+		if matchGlob(pattern, namespace) {
+			return true
+		}
+	}
+
+	// a namespace which can't be got isn't selected, so the tenant never takes a foreign event
+	if t.selector != nil && enricher != nil {
+		if ns := enricher.Namespace(namespace); ns != nil {
+			return t.selector.Matches(labels.Set(ns.Labels))
+		}
+	}
+
+	return false
+}
+
+func (t *Tenant) validate() error {
+	if t == nil {
+		return errors.New("blank tenant")
+	}
+	if len(t.Name) == 0 {
+		return errors.New("tenant requires name")
+	}
+	if len(t.Pipes) == 0 {
+		return errors.Errorf("tenant %s requires pipes", t.Name)
+	}
+	if len(t.Namespaces) == 0 && len(t.NamespaceSelector) == 0 {
+		return errors.Errorf("tenant %s requires namespaces or namespaceSelector", t.Name)
+	}
+
+	if err := (&Match{Clusters: t.Clusters, Namespaces: t.Namespaces}).validate(); err != nil {
+		return errors.Annotatef(err, "invalid tenant %s", t.Name)
+	}
+	if err := t.Match.validate(); err != nil {
+		return errors.Annotatef(err, "invalid match of tenant %s", t.Name)
+	}
+
+	if len(t.NamespaceSelector) != 0 {
+		selector, err := labels.Parse(t.NamespaceSelector)
+		if err != nil {
+			return errors.Annotatef(err, "invalid namespaceSelector of tenant %s", t.Name)
+		}
+		t.selector = selector
+	}
+
+	return nil
+}
+
+// ValidateTenants checks the tenants, a pipe can only be owned by one tenant.
+func ValidateTenants(tenants []*Tenant) error {
+	names := make(map[string]struct{}, len(tenants))
+	owners := make(map[string]string)
+	for _, tenant := range tenants {
+		if err := tenant.validate(); err != nil {
+			return err
+		}
+		if _, ok := names[tenant.Name]; ok {
+			return errors.Errorf("duplicated tenant %s", tenant.Name)
+		}
+		names[tenant.Name] = struct{}{}
+
+		for _, name := range tenant.Pipes {
+			if owner, ok := owners[name]; ok {
+				return errors.Errorf("pipe %s is owned by both tenant %s and %s", name, owner, tenant.Name)
+			}
+			owners[name] = tenant.Name
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,213 @@
+package routes
+
+import (
+	"reflect"
+	"testing"
+
+	apiCoreV1 "k8s.io/api/core/v1"
+	apisMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// testEnricher returns the namespaces with the labels, others can't be got.
+type testEnricher map[string]map[string]string
+
+func (e testEnricher) Namespace(name string) *apiCoreV1.Namespace {
+	nsLabels, ok := e[name]
+	if !ok {
+		return nil
+	}
+
+	return &apiCoreV1.Namespace{
+		ObjectMeta: apisMetaV1.ObjectMeta{
+			Name:   name,
+			Labels: nsLabels,
+		},
+	}
+}
+
+func TestTableRouteTenants(t *testing.T) {
+	pipeNames := []string{"s3", "pagerduty", "team-a", "team-a-audit", "team-b"}
+	enricher := testEnricher{
+		"payments": {"tenant": "team-b"},
+		"shared":   {"tenant": "none"},
+	}
+
+	tests := []struct {
+		name     string
+		config   *Config
+		tenants  []*Tenant
+		cluster  string
+		event    *apiCoreV1.Event
+		expected []string
+	}{
+		{
+			name:     "owned by glob namespaces",
+			tenants:  []*Tenant{{Name: "team-a", Namespaces: []string{"team-a-*"}, Pipes: []string{"team-a"}}},
+			event:    newTestEvent("team-a-web", "Pod", "Normal", "Started"),
+			expected: []string{"pagerduty", "s3", "team-a", "team-a-audit", "team-b"},
+		},
+		{
+			name:     "not owned events skip the tenant pipes",
+			tenants:  []*Tenant{{Name: "team-a", Namespaces: []string{"team-a-*"}, Pipes: []string{"team-a"}}},
+			event:    newTestEvent("default", "Pod", "Normal", "Started"),
+			expected: []string{"pagerduty", "s3", "team-a-audit", "team-b"},
+		},
+		{
+			name:     "owned by namespace selector",
+			tenants:  []*Tenant{{Name: "team-b", NamespaceSelector: "tenant=team-b", Pipes: []string{"team-b"}}},
+			event:    newTestEvent("payments", "Pod", "Normal", "Started"),
+			expected: []string{"pagerduty", "s3", "team-a", "team-a-audit", "team-b"},
+		},
+		{
+			name:     "unselected namespace is not owned",
+			tenants:  []*Tenant{{Name: "team-b", NamespaceSelector: "tenant=team-b", Pipes: []string{"team-b"}}},
+			event:    newTestEvent("shared", "Pod", "Normal", "Started"),
+			expected: []string{"pagerduty", "s3", "team-a", "team-a-audit"},
+		},
+		{
+			name:     "namespace which can't be got is not owned",
+			tenants:  []*Tenant{{Name: "team-b", NamespaceSelector: "tenant", Pipes: []string{"team-b"}}},
+			event:    newTestEvent("unknown", "Pod", "Normal", "Started"),
+			expected: []string{"pagerduty", "s3", "team-a", "team-a-audit"},
+		},
+		{
+			name:     "cluster-scoped event is not owned",
+			tenants:  []*Tenant{{Name: "team-a", Namespaces: []string{"*"}, Pipes: []string{"team-a"}}},
+			event:    newTestEvent("", "Node", "Warning", "NodeNotReady"),
+			expected: []string{"pagerduty", "s3", "team-a-audit", "team-b"},
+		},
+		{
+			name:     "tenant is restricted to the clusters",
+			tenants:  []*Tenant{{Name: "team-a", Clusters: []string{"prod"}, Namespaces: []string{"team-a-*"}, Pipes: []string{"team-a"}}},
+			cluster:  "staging",
+			event:    newTestEvent("team-a-web", "Pod", "Normal", "Started"),
+			expected: []string{"pagerduty", "s3", "team-a-audit", "team-b"},
+		},
+		{
+			name:    "tenant pipes receive the matched events only",
+			tenants: []*Tenant{{Name: "team-a", Namespaces: []string{"team-a-*"}, Match: &Match{Types: []string{"Warning"}}, Pipes: []string{"team-a"}}},
+			event:   newTestEvent("team-a-web", "Pod", "Normal", "Started"),
+			config: &Config{
+				Default: []string{"s3"},
+			},
+			expected: []string{"s3"},
+		},
+		{
+			name: "first owning tenant wins",
+			tenants: []*Tenant{
+				{Name: "team-a", Namespaces: []string{"team-*"}, Match: &Match{Types: []string{"Warning"}}, Pipes: []string{"team-a", "team-a-audit"}},
+				{Name: "team-b", Namespaces: []string{"team-b-*"}, Pipes: []string{"team-b"}},
+			},
+			event: newTestEvent("team-b-web", "Pod", "Normal", "Started"),
+			config: &Config{
+				Default: []string{"s3"},
+			},
+			expected: []string{"s3"},
+		},
+		{
+			name:    "tenant events still go to the shared pipes",
+			tenants: []*Tenant{{Name: "team-a", Namespaces: []string{"team-a-*"}, Pipes: []string{"team-a"}}},
+			event:   newTestEvent("team-a-web", "Pod", "Warning", "BackOff"),
+			config: &Config{
+				Rules: []*Rule{
+					{Match: &Match{Types: []string{"Warning"}}, Pipes: []string{"pagerduty"}},
+				},
+				Default: []string{"s3"},
+			},
+			expected: []string{"pagerduty", "team-a"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table, err := NewTable(tt.config, tt.tenants, nil, pipeNames)
+			if err != nil {
+				t.Fatalf("can't create table: %v", err)
+			}
+
+			actual := routedNames(table.Route(tt.cluster, tt.event, enricher))
+			if !reflect.DeepEqual(actual, tt.expected) {
+				t.Errorf("expected %v but got %v", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestNewTableValidatesTenants(t *testing.T) {
+	pipeNames := []string{"s3", "team-a", "team-b"}
+
+	tests := []struct {
+		name    string
+		config  *Config
+		tenants []*Tenant
+		scopes  []*Scope
+	}{
+		{
+			name:    "blank tenant",
+			tenants: []*Tenant{nil},
+		},
+		{
+			name:    "tenant without name",
+			tenants: []*Tenant{{Namespaces: []string{"team-a"}, Pipes: []string{"team-a"}}},
+		},
+		{
+			name:    "tenant without pipes",
+			tenants: []*Tenant{{Name: "team-a", Namespaces: []string{"team-a"}}},
+		},
+		{
+			name:    "tenant without namespaces",
+			tenants: []*Tenant{{Name: "team-a", Pipes: []string{"team-a"}}},
+		},
+		{
+			name:    "invalid namespace selector",
+			tenants: []*Tenant{{Name: "team-a", NamespaceSelector: "tenant in (", Pipes: []string{"team-a"}}},
+		},
+		{
+			name:    "invalid namespace pattern",
+			tenants: []*Tenant{{Name: "team-a", Namespaces: []string{"["}, Pipes: []string{"team-a"}}},
+		},
+		{
+			name: "duplicated tenant",
+			tenants: []*Tenant{
+				{Name: "team-a", Namespaces: []string{"team-a"}, Pipes: []string{"team-a"}},
+				{Name: "team-a", Namespaces: []string{"team-b"}, Pipes: []string{"team-b"}},
+			},
+		},
+		{
+			name: "pipe owned by two tenants",
+			tenants: []*Tenant{
+				{Name: "team-a", Namespaces: []string{"team-a"}, Pipes: []string{"team-a"}},
+				{Name: "team-b", Namespaces: []string{"team-b"}, Pipes: []string{"team-a"}},
+			},
+		},
+		{
+			name:    "unknown pipe of tenant",
+			tenants: []*Tenant{{Name: "team-a", Namespaces: []string{"team-a"}, Pipes: []string{"kafka"}}},
+		},
+		{
+			name:    "tenant pipe routed by rule",
+			config:  &Config{Rules: []*Rule{{Pipes: []string{"team-a"}}}},
+			tenants: []*Tenant{{Name: "team-a", Namespaces: []string{"team-a"}, Pipes: []string{"team-a"}}},
+		},
+		{
+			name:    "tenant pipe routed by default",
+			config:  &Config{Default: []string{"s3", "team-a"}},
+			tenants: []*Tenant{{Name: "team-a", Namespaces: []string{"team-a"}, Pipes: []string{"team-a"}}},
+		},
+		{
+			name:    "tenant pipe declared by scope",
+			tenants: []*Tenant{{Name: "team-a", Namespaces: []string{"team-a"}, Pipes: []string{"team-a"}}},
+			scopes: []*Scope{
+				{Cluster: "prod", Namespace: "team-a", Rules: []*Rule{{Pipes: []string{"team-a"}}}, Pipes: []string{"team-a"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewTable(tt.config, tt.tenants, tt.scopes, pipeNames); err == nil {
+				t.Error("expected error but got nil")
+			}
+		})
+	}
+}
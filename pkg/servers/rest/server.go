@@ -0,0 +1,235 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sirupsen/logrus"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/clusters"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/streams"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/utils/logger"
+)
+
+const (
+	sseKeepAlivePeriod = 30 * time.Second
+	shutdownTimeout    = 5 * time.Second
+)
+
+// ServerConfig represents the configuration of the HTTP server.
+type ServerConfig struct {
+	ListenAddress          string
+	Hub                    *streams.Hub
+	SubscriptionBufferSize int
+	ClusterStatuses        func() []clusters.Status
+}
+
+// Server exposes the events of all clusters by a read-only HTTP API:
+//   - GET /api/events returns the current contents of the watcher stores as JSON;
+//   - GET /api/events/stream streams the event changes as Server-Sent Events;
+//   - GET /api/clusters returns the running status of each cluster;
+//   - GET /metrics exposes the Prometheus metrics of the exporter.
+//
+// The events endpoints accept the cluster, namespace, kind, name, type and reason query
+// parameters (repeated or comma separated), and the since query parameter as a
+// RFC 3339 time or a duration before now, e.g. 15m.
+type Server struct {
+	logContext logrus.Fields
+
+	listenAddress          string
+	hub                    *streams.Hub
+	subscriptionBufferSize int
+	clusterStatuses        func() []clusters.Status
+
+	httpServer *http.Server
+	stopCh     <-chan struct{}
+}
+
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	filter, err := parseFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.hub.List(filter)); err != nil {
+		logrus.WithFields(s.logContext).WithError(err).Warnln("failed to write list response")
+	}
+}
+
+func (s *Server) handleClusters(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	statuses := make([]clusters.Status, 0)
+	if s.clusterStatuses != nil {
+		statuses = s.clusterStatuses()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(statuses); err != nil {
+		logrus.WithFields(s.logContext).WithError(err).Warnln("failed to write clusters response")
+	}
+}
+
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	filter, err := parseFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	subscription := s.hub.Subscribe(filter, s.subscriptionBufferSize)
+	defer func() {
+		subscription.Close()
+		if dropped := subscription.Dropped(); dropped != 0 {
+			logrus.WithFields(s.logContext).Warnf("subscriber %s dropped %d events", r.RemoteAddr, dropped)
+		}
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(sseKeepAlivePeriod)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-s.stopCh:
+			return
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case event := <-subscription.C():
+			data, err := json.Marshal(event)
+			if err != nil {
+				logrus.WithFields(s.logContext).WithError(err).Warnln("failed to marshal event")
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Operation, data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func (s *Server) Run(stopCh <-chan struct{}) error {
+	listener, err := net.Listen("tcp", s.listenAddress)
+	if err != nil {
+		return errors.Annotatef(err, "can't listen on %s", s.listenAddress)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/events", s.handleList)
+	mux.HandleFunc("/api/events/stream", s.handleStream)
+	mux.HandleFunc("/api/clusters", s.handleClusters)
+	mux.Handle("/metrics", promhttp.Handler())
+
+	s.stopCh = stopCh
+	s.httpServer = &http.Server{
+		Handler: mux,
+	}
+
+	go func() {
+		logrus.WithFields(s.logContext).Debugf("serving on %s", s.listenAddress)
+		if err := s.httpServer.Serve(listener); err != nil && err != http.ErrServerClosed {
+			logrus.WithFields(s.logContext).WithError(err).Errorln("stopped serving")
+		}
+	}()
+
+	go func() {
+		<-stopCh
+
+		logrus.WithFields(s.logContext).Debugln("stopping")
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		s.httpServer.Shutdown(ctx)
+		logrus.WithFields(s.logContext).Debugln("stopped")
+	}()
+
+	return nil
+}
+
+func NewServer(config *ServerConfig) *Server {
+	return &Server{
+		logContext: logger.CreateLogContext("SERVER<http>", ""),
+
+		listenAddress:          config.ListenAddress,
+		hub:                    config.Hub,
+		subscriptionBufferSize: config.SubscriptionBufferSize,
+		clusterStatuses:        config.ClusterStatuses,
+	}
+}
+
+func parseFilter(r *http.Request) (*streams.Filter, error) {
+	query := r.URL.Query()
+
+	filter := &streams.Filter{
+		Clusters:   queryValues(query["cluster"]),
+		Namespaces: queryValues(query["namespace"]),
+		Kinds:      queryValues(query["kind"]),
+		Names:      queryValues(query["name"]),
+		Types:      queryValues(query["type"]),
+		Reasons:    queryValues(query["reason"]),
+	}
+
+	if since := query.Get("since"); len(since) != 0 {
+		sinceTime, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			sinceDuration, durationErr := time.ParseDuration(since)
+			if durationErr != nil {
+				return nil, errors.Errorf("since %q is neither a RFC 3339 time nor a duration", since)
+			}
+			sinceTime = time.Now().Add(-sinceDuration)
+		}
+		filter.Since = &sinceTime
+	}
+
+	return filter, nil
+}
+
+func queryValues(values []string) []string {
+	var ret []string
+	for _, value := range values {
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); len(v) != 0 {
+				ret = append(ret, v)
+			}
+		}
+	}
+
+	return ret
+}
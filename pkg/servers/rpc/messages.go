@@ -0,0 +1,17 @@
+package rpc
+
+import (
+	"github.com/thxcode/kubernetes-event-exporter/pkg/streams"
+)
+
+type SubscribeRequest struct {
+	Filter *streams.Filter `json:"filter,omitempty"`
+}
+
+type ListRequest struct {
+	Filter *streams.Filter `json:"filter,omitempty"`
+}
+
+type ListResponse struct {
+	Events []*streams.Event `json:"events"`
+}
@@ -0,0 +1,170 @@
+package rpc
+
+import (
+	"context"
+	"net"
+
+	"github.com/juju/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/streams"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/utils/logger"
+	"google.golang.org/grpc"
+)
+
+const serviceName = "kubernetes.event.exporter.v1.EventExporter"
+
+// ServerConfig represents the configuration of the gRPC server.
+type ServerConfig struct {
+	ListenAddress          string
+	Hub                    *streams.Hub
+	SubscriptionBufferSize int
+}
+
+// Server exposes the events of all clusters by gRPC:
+//   - Subscribe streams the event changes which match the filter;
+//   - List returns the current contents of the watcher stores.
+//
+// There is no proto file, the messages are JSON documents of the request and response
+// types, so the clients must call with the content-subtype "json", i.e. the content-type
+// "application/grpc+json", and a codec passing JSON:
+//
+//	/kubernetes.event.exporter.v1.EventExporter/List (unary)
+//	  request:  {"filter": {"namespaces": ["default"], "reasons": ["BackOff"]}}
+//	  response: {"events": [{"cluster": "prod", "operation": "sync", "event": {...}}]}
+//	/kubernetes.event.exporter.v1.EventExporter/Subscribe (server streaming)
+//	  request:  {"filter": {...}}
+//	  messages: {"cluster": "prod", "operation": "add", "event": {...}}
+//
+// The filter is a streams.Filter, a blank filter selects all events, and the event is
+// the Kubernetes Event in its JSON form.
+type Server struct {
+	logContext logrus.Fields
+
+	listenAddress          string
+	hub                    *streams.Hub
+	subscriptionBufferSize int
+
+	grpcServer *grpc.Server
+	stopCh     <-chan struct{}
+}
+
+func (s *Server) Subscribe(req *SubscribeRequest, stream grpc.ServerStream) error {
+	subscription := s.hub.Subscribe(req.Filter, s.subscriptionBufferSize)
+	defer func() {
+		subscription.Close()
+		if dropped := subscription.Dropped(); dropped != 0 {
+			logrus.WithFields(s.logContext).Warnf("subscriber dropped %d events", dropped)
+		}
+	}()
+
+	for {
+		select {
+		case <-s.stopCh:
+			return nil
+		case <-stream.Context().Done():
+			return nil
+		case event := <-subscription.C():
+			if err := stream.SendMsg(event); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *Server) List(_ context.Context, req *ListRequest) (*ListResponse, error) {
+	return &ListResponse{
+		Events: s.hub.List(req.Filter),
+	}, nil
+}
+
+func (s *Server) Run(stopCh <-chan struct{}) error {
+	listener, err := net.Listen("tcp", s.listenAddress)
+	if err != nil {
+		return errors.Annotatef(err, "can't listen on %s", s.listenAddress)
+	}
+
+	s.stopCh = stopCh
+	s.grpcServer = grpc.NewServer()
+	s.grpcServer.RegisterService(&serviceDesc, s)
+
+	go func() {
+		logrus.WithFields(s.logContext).Debugf("serving on %s", s.listenAddress)
+		if err := s.grpcServer.Serve(listener); err != nil {
+			logrus.WithFields(s.logContext).WithError(err).Errorln("stopped serving")
+		}
+	}()
+
+	go func() {
+		<-stopCh
+
+		logrus.WithFields(s.logContext).Debugln("stopping")
+		s.grpcServer.GracefulStop()
+		logrus.WithFields(s.logContext).Debugln("stopped")
+	}()
+
+	return nil
+}
+
+func NewServer(config *ServerConfig) *Server {
+	return &Server{
+		logContext: logger.CreateLogContext("SERVER<grpc>", ""),
+
+		listenAddress:          config.ListenAddress,
+		hub:                    config.Hub,
+		subscriptionBufferSize: config.SubscriptionBufferSize,
+	}
+}
+
+type eventExporterServer interface {
+	Subscribe(*SubscribeRequest, grpc.ServerStream) error
+	List(context.Context, *ListRequest) (*ListResponse, error)
+}
+
+func subscribeHandler(srv interface{}, stream grpc.ServerStream) error {
+	req := &SubscribeRequest{}
+	if err := stream.RecvMsg(req); err != nil {
+		return err
+	}
+
+	return srv.(eventExporterServer).Subscribe(req, stream)
+}
+
+func listHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	req := &ListRequest{}
+	if err := dec(req); err != nil {
+		return nil, err
+	}
+
+	if interceptor == nil {
+		return srv.(eventExporterServer).List(ctx, req)
+	}
+
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/" + serviceName + "/List",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(eventExporterServer).List(ctx, req.(*ListRequest))
+	}
+	return interceptor(ctx, req, info, handler)
+}
+
+// serviceDesc is written by hand rather than generated from a proto file,
+// as the messages are encoded by the json codec.
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*eventExporterServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "List",
+			Handler:    listHandler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Subscribe",
+			Handler:       subscribeHandler,
+			ServerStreams: true,
+		},
+	},
+}
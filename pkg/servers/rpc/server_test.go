@@ -0,0 +1,160 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/thxcode/kubernetes-event-exporter/pkg/streams"
+	"google.golang.org/grpc"
+	apiCoreV1 "k8s.io/api/core/v1"
+	apisMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// rawCodec passes the messages as they are, so that the wire format can be checked.
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	return *(v.(*[]byte)), nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	*(v.(*[]byte)) = append([]byte(nil), data...)
+	return nil
+}
+
+func (rawCodec) String() string {
+	return CodecName
+}
+
+func newTestEvent(namespace, name, reason string) *apiCoreV1.Event {
+	return &apiCoreV1.Event{
+		ObjectMeta: apisMetaV1.ObjectMeta{
+			Namespace: namespace,
+			Name:      name,
+		},
+		InvolvedObject: apiCoreV1.ObjectReference{
+			Namespace: namespace,
+			Kind:      "Pod",
+			Name:      "nginx",
+		},
+		Reason: reason,
+		Type:   apiCoreV1.EventTypeWarning,
+	}
+}
+
+func runTestServer(t *testing.T, hub *streams.Hub) *grpc.ClientConn {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("can't find a free port: %v", err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	stopCh := make(chan struct{})
+	t.Cleanup(func() { close(stopCh) })
+	if err := NewServer(&ServerConfig{ListenAddress: address, Hub: hub}).Run(stopCh); err != nil {
+		t.Fatalf("can't run the server: %v", err)
+	}
+
+	conn, err := grpc.Dial(address, grpc.WithInsecure(), grpc.WithDefaultCallOptions(grpc.CallContentSubtype(CodecName)))
+	if err != nil {
+		t.Fatalf("can't dial the server: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+func TestServerList(t *testing.T) {
+	store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	store.Add(newTestEvent("default", "nginx.1", "BackOff"))
+	store.Add(newTestEvent("kube-system", "dns.1", "Unhealthy"))
+	hub := streams.NewHub()
+	hub.RegisterStore("prod", store, nil)
+
+	conn := runTestServer(t, hub)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp := &ListResponse{}
+	req := &ListRequest{Filter: &streams.Filter{Namespaces: []string{"default"}}}
+	if err := conn.Invoke(ctx, "/"+serviceName+"/List", req, resp); err != nil {
+		t.Fatalf("can't list: %v", err)
+	}
+	if len(resp.Events) != 1 || resp.Events[0].Event.Name != "nginx.1" {
+		t.Fatalf("expected event nginx.1 but got %+v", resp.Events)
+	}
+
+	// the messages are plain JSON documents of the request and response types
+	raw := []byte(`{"filter":{"namespaces":["kube-system"]}}`)
+	var rawResp []byte
+	if err := conn.Invoke(ctx, "/"+serviceName+"/List", &raw, &rawResp, grpc.CallCustomCodec(rawCodec{})); err != nil {
+		t.Fatalf("can't list by raw JSON: %v", err)
+	}
+	var decoded struct {
+		Events []struct {
+			Cluster   string `json:"cluster"`
+			Operation string `json:"operation"`
+			Event     struct {
+				Metadata struct {
+					Name string `json:"name"`
+				} `json:"metadata"`
+			} `json:"event"`
+		} `json:"events"`
+	}
+	if err := json.Unmarshal(rawResp, &decoded); err != nil {
+		t.Fatalf("expected JSON response but got %s: %v", rawResp, err)
+	}
+	if len(decoded.Events) != 1 || decoded.Events[0].Cluster != "prod" ||
+		decoded.Events[0].Operation != "sync" || decoded.Events[0].Event.Metadata.Name != "dns.1" {
+		t.Errorf("expected event dns.1 of prod but got %s", rawResp)
+	}
+}
+
+func TestServerSubscribe(t *testing.T) {
+	hub := streams.NewHub()
+	conn := runTestServer(t, hub)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, "/"+serviceName+"/Subscribe")
+	if err != nil {
+		t.Fatalf("can't subscribe: %v", err)
+	}
+	if err := stream.SendMsg(&SubscribeRequest{Filter: &streams.Filter{Reasons: []string{"BackOff"}}}); err != nil {
+		t.Fatalf("can't send the request: %v", err)
+	}
+	if err := stream.CloseSend(); err != nil {
+		t.Fatalf("can't close sending: %v", err)
+	}
+
+	// keep publishing until the subscription is registered by the server
+	publishCtx, publishCancel := context.WithCancel(ctx)
+	defer publishCancel()
+	go func() {
+		ticker := time.NewTicker(50 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			hub.Publish(&streams.Event{Cluster: "prod", Operation: streams.OperationAdd, Event: newTestEvent("default", "dns.1", "Unhealthy")})
+			hub.Publish(&streams.Event{Cluster: "prod", Operation: streams.OperationAdd, Event: newTestEvent("default", "nginx.1", "BackOff")})
+			select {
+			case <-publishCtx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	event := &streams.Event{}
+	if err := stream.RecvMsg(event); err != nil {
+		t.Fatalf("can't receive: %v", err)
+	}
+	if event.Cluster != "prod" || event.Operation != streams.OperationAdd || event.Event.Name != "nginx.1" {
+		t.Errorf("expected the added event nginx.1 of prod but got %+v", event)
+	}
+}
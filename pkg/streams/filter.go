@@ -0,0 +1,74 @@
+package streams
+
+import (
+	"time"
+
+	"github.com/thxcode/kubernetes-event-exporter/pkg/expressions"
+	apiCoreV1 "k8s.io/api/core/v1"
+)
+
+// Filter selects the events by their cluster and involved object,
+// a blank field matches anything.
+type Filter struct {
+	Clusters   []string `json:"clusters,omitempty"`
+	Namespaces []string `json:"namespaces,omitempty"`
+	Kinds      []string `json:"kinds,omitempty"`
+	Names      []string `json:"names,omitempty"`
+	Types      []string `json:"types,omitempty"`
+	Reasons    []string `json:"reasons,omitempty"`
+	// Since selects the events which happened at or after the time.
+	Since *time.Time `json:"since,omitempty"`
+	// Expression selects the events by a CEL expression, see expressions.Expression.
+	Expression *expressions.Expression `json:"expression,omitempty"`
+}
+
+func (f *Filter) Match(cluster string, event *apiCoreV1.Event) bool {
+	return f.MatchEnriched(cluster, event, nil)
+}
+
+// MatchEnriched is like Match, but the expression can refer to the data got by the enricher.
+func (f *Filter) MatchEnriched(cluster string, event *apiCoreV1.Event, enricher expressions.Enricher) bool {
+	if f == nil {
+		return true
+	}
+
+	involvedObject := event.InvolvedObject
+
+	return matchAny(f.Clusters, cluster) &&
+		matchAny(f.Namespaces, involvedObject.Namespace) &&
+		matchAny(f.Kinds, involvedObject.Kind) &&
+		matchAny(f.Names, involvedObject.Name) &&
+		matchAny(f.Types, event.Type) &&
+		matchAny(f.Reasons, event.Reason) &&
+		(f.Since == nil || !LastSeen(event).Before(*f.Since)) &&
+		f.Expression.Match(cluster, event, enricher)
+}
+
+// LastSeen returns the last time the event happened.
+func LastSeen(event *apiCoreV1.Event) time.Time {
+	if !event.LastTimestamp.IsZero() {
+		return event.LastTimestamp.Time
+	}
+	if !event.EventTime.IsZero() {
+		return event.EventTime.Time
+	}
+	if !event.FirstTimestamp.IsZero() {
+		return event.FirstTimestamp.Time
+	}
+
+	return event.CreationTimestamp.Time
+}
+
+func matchAny(candidates []string, value string) bool {
+	if len(candidates) == 0 {
+		return true
+	}
+
+	for _, candidate := range candidates {
+		if candidate == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,188 @@
+package streams
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	apiCoreV1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+type Operation string
+
+const (
+	OperationAdd    Operation = "add"
+	OperationUpdate Operation = "update"
+	OperationDelete Operation = "delete"
+	// OperationSync represents an event received by the initial list (or relist)
+	// from the Kubernetes API server, it may have been seen before.
+	OperationSync Operation = "sync"
+
+	DefaultSubscriptionBufferSize = 1024
+)
+
+// Event is the normalized form of an event change that is delivered to the subscribers.
+type Event struct {
+	Cluster   string           `json:"cluster"`
+	Operation Operation        `json:"operation"`
+	Event     *apiCoreV1.Event `json:"event"`
+}
+
+// Subscription receives the published events which match its filter. A subscriber
+// which can't keep up with the publishing doesn't block the others, the events
+// overflowing its buffer are dropped and counted instead.
+type Subscription struct {
+	hub     *Hub
+	filter  *Filter
+	ch      chan *Event
+	dropped uint64
+
+	closeOnce sync.Once
+}
+
+func (s *Subscription) C() <-chan *Event {
+	return s.ch
+}
+
+func (s *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+func (s *Subscription) Close() {
+	s.closeOnce.Do(func() {
+		s.hub.unsubscribe(s)
+		close(s.ch)
+	})
+}
+
+func (s *Subscription) deliver(event *Event) {
+	select {
+	case s.ch <- event:
+	default:
+		atomic.AddUint64(&s.dropped, 1)
+	}
+}
+
+// StoreView returns the event as the subscribers see it, e.g. after the redaction,
+// or false if the event is hidden from them.
+type StoreView func(event *apiCoreV1.Event) (*apiCoreV1.Event, bool)
+
+type viewedStore struct {
+	store cache.Store
+	view  StoreView
+}
+
+// Hub fans out the events of all clusters to the subscribers, and keeps
+// the watcher stores of the clusters for listing their current contents.
+type Hub struct {
+	subscriptionsLock sync.RWMutex
+	subscriptions     map[*Subscription]struct{}
+
+	storesLock sync.RWMutex
+	stores     map[string]viewedStore
+}
+
+// RegisterStore registers the store of a cluster, the listed events are passed
+// through the view, a nil view lists the events as they are.
+func (h *Hub) RegisterStore(cluster string, store cache.Store, view StoreView) {
+	h.storesLock.Lock()
+	defer h.storesLock.Unlock()
+
+	h.stores[cluster] = viewedStore{store: store, view: view}
+}
+
+func (h *Hub) UnregisterStore(cluster string) {
+	h.storesLock.Lock()
+	defer h.storesLock.Unlock()
+
+	delete(h.stores, cluster)
+}
+
+// List returns the events inside the registered stores which match the filter,
+// ordered by cluster, namespace and name.
+func (h *Hub) List(filter *Filter) []*Event {
+	h.storesLock.RLock()
+	defer h.storesLock.RUnlock()
+
+	ret := make([]*Event, 0)
+	for cluster, vs := range h.stores {
+		for _, obj := range vs.store.List() {
+			event, ok := obj.(*apiCoreV1.Event)
+			if !ok {
+				continue
+			}
+			if vs.view != nil {
+				if event, ok = vs.view(event); !ok {
+					continue
+				}
+			}
+			if !filter.Match(cluster, event) {
+				continue
+			}
+
+			ret = append(ret, &Event{
+				Cluster:   cluster,
+				Operation: OperationSync,
+				Event:     event,
+			})
+		}
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Cluster != ret[j].Cluster {
+			return ret[i].Cluster < ret[j].Cluster
+		}
+		if ret[i].Event.Namespace != ret[j].Event.Namespace {
+			return ret[i].Event.Namespace < ret[j].Event.Namespace
+		}
+		return ret[i].Event.Name < ret[j].Event.Name
+	})
+
+	return ret
+}
+
+// Subscribe creates a subscription for the events matching the filter,
+// the caller must close it when it is no longer used.
+func (h *Hub) Subscribe(filter *Filter, bufferSize int) *Subscription {
+	if bufferSize <= 0 {
+		bufferSize = DefaultSubscriptionBufferSize
+	}
+
+	s := &Subscription{
+		hub:    h,
+		filter: filter,
+		ch:     make(chan *Event, bufferSize),
+	}
+
+	h.subscriptionsLock.Lock()
+	h.subscriptions[s] = struct{}{}
+	h.subscriptionsLock.Unlock()
+
+	return s
+}
+
+func (h *Hub) unsubscribe(s *Subscription) {
+	h.subscriptionsLock.Lock()
+	defer h.subscriptionsLock.Unlock()
+
+	delete(h.subscriptions, s)
+}
+
+func (h *Hub) Publish(event *Event) {
+	h.subscriptionsLock.RLock()
+	defer h.subscriptionsLock.RUnlock()
+
+	for s := range h.subscriptions {
+		if s.filter.Match(event.Cluster, event.Event) {
+			s.deliver(event)
+		}
+	}
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		subscriptions: make(map[*Subscription]struct{}),
+		stores:        make(map[string]viewedStore),
+	}
+}
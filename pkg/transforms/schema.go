@@ -0,0 +1,119 @@
+package transforms
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"github.com/juju/errors"
+	apiCoreV1 "k8s.io/api/core/v1"
+)
+
+var (
+	eventType     = reflect.TypeOf(apiCoreV1.Event{})
+	marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// eventField resolves the dotted path against the json form of the event, and returns
+// the type of the field, a segment after a map field addresses a key of the map.
+// The paths into the lists are not supported, as the values of the lists can't be
+// addressed by the dotted paths.
+func eventField(path string) ([]string, reflect.Type, error) {
+	if len(path) == 0 {
+		return nil, nil, errors.New("blank field")
+	}
+
+	segments := strings.Split(path, ".")
+	t := eventType
+	for i, segment := range segments {
+		if len(segment) == 0 {
+			return nil, nil, errors.Errorf("blank segment in field %s", path)
+		}
+
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+
+		switch {
+		case isJSONScalar(t):
+			return nil, nil, errors.NotFoundf("field %s, as %s is a scalar", path, strings.Join(segments[:i], "."))
+		case t.Kind() == reflect.Map:
+			t = t.Elem()
+		case t.Kind() == reflect.Struct:
+			field, ok := jsonField(t, segment)
+			if !ok {
+				return nil, nil, errors.NotFoundf("field %s of event", path)
+			}
+			t = field
+		default:
+			return nil, nil, errors.NotFoundf("field %s, as %s is not a map or an object", path, strings.Join(segments[:i], "."))
+		}
+	}
+
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return segments, t, nil
+}
+
+// jsonField finds the field of the struct by its json name, including the inlined fields.
+func jsonField(t reflect.Type, name string) (reflect.Type, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		tagName := strings.Split(field.Tag.Get("json"), ",")[0]
+		if tagName == "-" {
+			continue
+		}
+		if len(tagName) == 0 && field.Anonymous {
+			inlined := field.Type
+			for inlined.Kind() == reflect.Ptr {
+				inlined = inlined.Elem()
+			}
+			if inlined.Kind() == reflect.Struct {
+				if ft, ok := jsonField(inlined, name); ok {
+					return ft, true
+				}
+			}
+			continue
+		}
+		if len(tagName) == 0 {
+			tagName = field.Name
+		}
+
+		if tagName == name {
+			return field.Type, true
+		}
+	}
+
+	return nil, false
+}
+
+// isJSONScalar returns true if the type is encoded as a json scalar,
+// e.g. the API times are encoded as strings.
+func isJSONScalar(t reflect.Type) bool {
+	if t.Implements(marshalerType) || reflect.PtrTo(t).Implements(marshalerType) {
+		return true
+	}
+
+	switch t.Kind() {
+	case reflect.Map, reflect.Struct, reflect.Slice, reflect.Array, reflect.Interface:
+		return false
+	}
+	return true
+}
+
+// isString returns true if the field is a plain string.
+func isString(t reflect.Type) bool {
+	return t.Kind() == reflect.String && !t.Implements(marshalerType)
+}
+
+// isStrings returns true if the field is a plain string, or a map or a list of them.
+func isStrings(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Map, reflect.Slice:
+		return isStrings(t.Elem())
+	}
+
+	return isString(t)
+}
@@ -0,0 +1,326 @@
+package transforms
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/streams"
+	apiCoreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	defaultField       = "message"
+	defaultReplacement = "***"
+	defaultSuffix      = "..."
+
+	// clusterPlaceholder is replaced by the cluster name in the label values.
+	clusterPlaceholder = "{cluster}"
+)
+
+// Rule is a step of the transformation, which takes exactly one action. The fields
+// are addressed by the dotted paths of the event json, e.g. message, source.host or
+// metadata.annotations, and are checked against the event on compiling. The rule
+// only applies to the events matching its filter.
+type Rule struct {
+	Match *streams.Filter `json:"match,omitempty"`
+
+	Redact   *RedactRule   `json:"redact,omitempty"`
+	Drop     *DropRule     `json:"drop,omitempty"`
+	Label    *LabelRule    `json:"label,omitempty"`
+	Rename   *RenameRule   `json:"rename,omitempty"`
+	Truncate *TruncateRule `json:"truncate,omitempty"`
+}
+
+// RedactRule replaces the matches of the pattern inside the string values of the fields,
+// a map or a list of strings redacts all the strings inside it, a blank pattern replaces
+// the whole value. The fields default to the message.
+type RedactRule struct {
+	Fields      []string `json:"fields,omitempty"`
+	Pattern     string   `json:"pattern,omitempty"`
+	Replacement *string  `json:"replacement,omitempty"`
+}
+
+// DropRule removes the fields.
+type DropRule struct {
+	Fields []string `json:"fields"`
+}
+
+// LabelRule sets the labels of the events, "{cluster}" inside a value is
+// replaced by the cluster name.
+type LabelRule struct {
+	Labels map[string]string `json:"labels"`
+}
+
+// RenameRule moves the value of a field to another, the target must be a field
+// of the event in the same type, e.g. a key of metadata.labels.
+type RenameRule struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// TruncateRule cuts the string fields down to the max length in runes, including
+// the suffix appended to the truncated values. The fields default to the message.
+type TruncateRule struct {
+	Fields    []string `json:"fields,omitempty"`
+	MaxLength int      `json:"maxLength"`
+	Suffix    *string  `json:"suffix,omitempty"`
+}
+
+type step struct {
+	match *streams.Filter
+	apply func(cluster string, obj map[string]interface{})
+}
+
+// Chain applies the rules in order, it is safe for concurrent use.
+type Chain struct {
+	steps []step
+}
+
+// IsEmpty returns true if the chain has nothing to apply.
+func (c *Chain) IsEmpty() bool {
+	return c == nil || len(c.steps) == 0
+}
+
+// Apply returns the transformed copy of the event, the given event is never changed,
+// as it is shared with the watcher cache. The event is returned as it is if no rule
+// applies to it.
+func (c *Chain) Apply(cluster string, event *apiCoreV1.Event) (*apiCoreV1.Event, error) {
+	if c.IsEmpty() || event == nil {
+		return event, nil
+	}
+
+	var obj map[string]interface{}
+	for _, s := range c.steps {
+		if !s.match.Match(cluster, event) {
+			continue
+		}
+
+		if obj == nil {
+			var err error
+			if obj, err = runtime.DefaultUnstructuredConverter.ToUnstructured(event); err != nil {
+				return nil, errors.Annotate(err, "can't convert event")
+			}
+		}
+		s.apply(cluster, obj)
+	}
+	if obj == nil {
+		return event, nil
+	}
+
+	transformed := &apiCoreV1.Event{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj, transformed); err != nil {
+		return nil, errors.Annotate(err, "can't convert transformed event")
+	}
+
+	return transformed, nil
+}
+
+// NewChain validates and compiles the rules.
+func NewChain(rules []*Rule) (*Chain, error) {
+	c := &Chain{
+		steps: make([]step, 0, len(rules)),
+	}
+
+	for i, rule := range rules {
+		apply, err := compile(rule)
+		if err != nil {
+			return nil, errors.Annotatef(err, "invalid transform #%d", i)
+		}
+
+		c.steps = append(c.steps, step{
+			match: rule.Match,
+			apply: apply,
+		})
+	}
+
+	return c, nil
+}
+
+func compile(rule *Rule) (func(string, map[string]interface{}), error) {
+	if rule == nil {
+		return nil, errors.New("blank rule")
+	}
+
+	actions := 0
+	for _, set := range []bool{rule.Redact != nil, rule.Drop != nil, rule.Label != nil, rule.Rename != nil, rule.Truncate != nil} {
+		if set {
+			actions++
+		}
+	}
+	if actions != 1 {
+		return nil, errors.New("rule requires exactly one of redact, drop, label, rename or truncate")
+	}
+
+	switch {
+	case rule.Redact != nil:
+		return compileRedact(rule.Redact)
+	case rule.Drop != nil:
+		return compileDrop(rule.Drop)
+	case rule.Label != nil:
+		return compileLabel(rule.Label)
+	case rule.Rename != nil:
+		return compileRename(rule.Rename)
+	}
+
+	return compileTruncate(rule.Truncate)
+}
+
+func compileRedact(r *RedactRule) (func(string, map[string]interface{}), error) {
+	fields, err := parsePaths(r.Fields, isStrings, "a string, or a map or list of strings")
+	if err != nil {
+		return nil, err
+	}
+
+	var pattern *regexp.Regexp
+	if len(r.Pattern) != 0 {
+		if pattern, err = regexp.Compile(r.Pattern); err != nil {
+			return nil, errors.Annotatef(err, "can't compile pattern %s", r.Pattern)
+		}
+	}
+
+	replacement := defaultReplacement
+	if r.Replacement != nil {
+		replacement = *r.Replacement
+	}
+
+	var redact func(value interface{}) interface{}
+	redact = func(value interface{}) interface{} {
+		switch v := value.(type) {
+		case string:
+			if pattern == nil {
+				return replacement
+			}
+			return pattern.ReplaceAllString(v, replacement)
+		case map[string]interface{}:
+			for key, item := range v {
+				v[key] = redact(item)
+			}
+		case []interface{}:
+			for i, item := range v {
+				v[i] = redact(item)
+			}
+		}
+		return value
+	}
+
+	return func(_ string, obj map[string]interface{}) {
+		for _, field := range fields {
+			if value, ok, _ := unstructured.NestedFieldNoCopy(obj, field...); ok {
+				unstructured.SetNestedField(obj, redact(value), field...)
+			}
+		}
+	}, nil
+}
+
+func compileDrop(r *DropRule) (func(string, map[string]interface{}), error) {
+	if len(r.Fields) == 0 {
+		return nil, errors.New("drop requires fields")
+	}
+	fields, err := parsePaths(r.Fields, nil, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return func(_ string, obj map[string]interface{}) {
+		for _, field := range fields {
+			unstructured.RemoveNestedField(obj, field...)
+		}
+	}, nil
+}
+
+func compileLabel(r *LabelRule) (func(string, map[string]interface{}), error) {
+	if len(r.Labels) == 0 {
+		return nil, errors.New("label requires labels")
+	}
+
+	return func(cluster string, obj map[string]interface{}) {
+		labels, _, _ := unstructured.NestedStringMap(obj, "metadata", "labels")
+		if labels == nil {
+			labels = make(map[string]string, len(r.Labels))
+		}
+		for key, value := range r.Labels {
+			labels[key] = strings.Replace(value, clusterPlaceholder, cluster, -1)
+		}
+		unstructured.SetNestedStringMap(obj, labels, "metadata", "labels")
+	}, nil
+}
+
+func compileRename(r *RenameRule) (func(string, map[string]interface{}), error) {
+	if len(r.From) == 0 || len(r.To) == 0 {
+		return nil, errors.New("rename requires from and to")
+	}
+	from, fromType, err := eventField(r.From)
+	if err != nil {
+		return nil, err
+	}
+	to, toType, err := eventField(r.To)
+	if err != nil {
+		return nil, err
+	}
+	if fromType != toType {
+		return nil, errors.Errorf("can't rename %s of %s to %s of %s", r.From, fromType, r.To, toType)
+	}
+
+	return func(_ string, obj map[string]interface{}) {
+		value, ok, _ := unstructured.NestedFieldNoCopy(obj, from...)
+		if !ok {
+			return
+		}
+		unstructured.RemoveNestedField(obj, from...)
+		unstructured.SetNestedField(obj, value, to...)
+	}, nil
+}
+
+func compileTruncate(r *TruncateRule) (func(string, map[string]interface{}), error) {
+	fields, err := parsePaths(r.Fields, isString, "a string")
+	if err != nil {
+		return nil, err
+	}
+
+	suffix := defaultSuffix
+	if r.Suffix != nil {
+		suffix = *r.Suffix
+	}
+	suffixLen := len([]rune(suffix))
+	if r.MaxLength <= suffixLen {
+		return nil, errors.Errorf("truncate requires maxLength longer than the suffix %q", suffix)
+	}
+
+	return func(_ string, obj map[string]interface{}) {
+		for _, field := range fields {
+			value, ok, _ := unstructured.NestedString(obj, field...)
+			if !ok {
+				continue
+			}
+			if runes := []rune(value); len(runes) > r.MaxLength {
+				unstructured.SetNestedField(obj, string(runes[:r.MaxLength-suffixLen])+suffix, field...)
+			}
+		}
+	}, nil
+}
+
+// parsePaths resolves the dotted paths against the event, blank paths mean the message.
+// The fields must be accepted by the given check if any.
+func parsePaths(paths []string, accept func(reflect.Type) bool, expected string) ([][]string, error) {
+	if len(paths) == 0 {
+		paths = []string{defaultField}
+	}
+
+	ret := make([][]string, 0, len(paths))
+	for _, path := range paths {
+		field, fieldType, err := eventField(path)
+		if err != nil {
+			return nil, err
+		}
+		if accept != nil && !accept(fieldType) {
+			return nil, errors.Errorf("field %s is not %s", path, expected)
+		}
+		ret = append(ret, field)
+	}
+
+	return ret, nil
+}
@@ -19,11 +19,11 @@ const (
 	blue   = 36
 	gray   = 37
 
-	LogKubernetesHostKey = "log-k8s-host"
-	LogScopeKey          = "log-scope"
-	indentSpace          = "           "
-	indentPoint          = "    └────> "
-	breakChar            = '\n'
+	LogClusterKey = "log-cluster"
+	LogScopeKey   = "log-scope"
+	indentSpace   = "           "
+	indentPoint   = "    └────> "
+	breakChar     = '\n'
 )
 
 var (
@@ -55,7 +55,7 @@ func (f *simpleFormatter) Format(entry *logrus.Entry) ([]byte, error) {
 
 	keys := make([]string, 0, len(entry.Data))
 	for k := range entry.Data {
-		if k != LogKubernetesHostKey && k != LogScopeKey && k != logrus.ErrorKey {
+		if k != LogClusterKey && k != LogScopeKey && k != logrus.ErrorKey {
 			keys = append(keys, k)
 		}
 	}
@@ -85,11 +85,11 @@ func (f *simpleFormatter) Format(entry *logrus.Entry) ([]byte, error) {
 		fmt.Fprintf(b, "%s[%04d]", strings.ToUpper(entry.Level.String())[0:4], int(entry.Time.Sub(baseTimestamp)/time.Second))
 	}
 
-	if logK8sHostData := entry.Data[LogKubernetesHostKey]; logK8sHostData != nil {
+	if logClusterData := entry.Data[LogClusterKey]; logClusterData != nil {
 		if f.isTerminal {
-			fmt.Fprintf(b, " \x1b[3m%-44.44s\x1b[0m", logK8sHostData)
+			fmt.Fprintf(b, " \x1b[3m%-44.44s\x1b[0m", logClusterData)
 		} else {
-			fmt.Fprintf(b, " %-44.44s", logK8sHostData)
+			fmt.Fprintf(b, " %-44.44s", logClusterData)
 		}
 	} else {
 		fmt.Fprintf(b, " %-44s", " ")
@@ -157,20 +157,20 @@ func (f *simpleFormatter) Format(entry *logrus.Entry) ([]byte, error) {
 	return b.Bytes(), nil
 }
 
-func CreateLogContext(scope, kubernetesHost string) logrus.Fields {
+func CreateLogContext(scope, cluster string) logrus.Fields {
 	if len(scope) == 0 {
 		scope = "main"
 	}
 
-	if len(kubernetesHost) == 0 {
+	if len(cluster) == 0 {
 		return logrus.Fields{
 			LogScopeKey: scope,
 		}
 	}
 
 	return logrus.Fields{
-		LogKubernetesHostKey: kubernetesHost,
-		LogScopeKey:          scope,
+		LogClusterKey: cluster,
+		LogScopeKey:   scope,
 	}
 }
 
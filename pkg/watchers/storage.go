@@ -1,11 +1,18 @@
 package watchers
 
 import (
+	"sync"
 	"time"
 
 	"k8s.io/client-go/tools/cache"
 )
 
+// ExpirationHandler can be implemented by the store handler to be notified of
+// the objects which are removed by the storage TTL rather than the API.
+type ExpirationHandler interface {
+	OnExpire(obj interface{})
+}
+
 // WatcherStoreConfig represents the configuration of the storage backing the watcher.
 type WatcherStoreConfig struct {
 	KeyFunc    cache.KeyFunc
@@ -16,13 +23,20 @@ type WatcherStoreConfig struct {
 type watcherStore struct {
 	cache.Store
 
+	keyFunc cache.KeyFunc
 	handler cache.ResourceEventHandler
+
+	// objects tracks the stored objects, the TTL store removes the expired
+	// objects silently, so they are found by comparing against it.
+	objects     map[string]interface{}
+	objectsLock sync.Mutex
 }
 
 func (s *watcherStore) Add(obj interface{}) error {
 	if err := s.Store.Add(obj); err != nil {
 		return err
 	}
+	s.track(obj)
 	s.handler.OnAdd(obj)
 	return nil
 }
@@ -36,6 +50,7 @@ func (s *watcherStore) Update(obj interface{}) error {
 	if err = s.Store.Update(obj); err != nil {
 		return err
 	}
+	s.track(obj)
 	s.handler.OnUpdate(oldObj, obj)
 	return nil
 }
@@ -44,13 +59,93 @@ func (s *watcherStore) Delete(obj interface{}) error {
 	if err := s.Store.Delete(obj); err != nil {
 		return err
 	}
+	s.untrack(obj)
 	s.handler.OnDelete(obj)
 	return nil
 }
 
+// Replace notifies the handler of the objects which are missing from the relist,
+// e.g. the deletions which were missed while the watch was broken, as tombstones.
+func (s *watcherStore) Replace(list []interface{}, resourceVersion string) error {
+	// report the objects which have aged out as expired rather than deleted
+	s.expire()
+
+	if err := s.Store.Replace(list, resourceVersion); err != nil {
+		return err
+	}
+
+	objects := make(map[string]interface{}, len(list))
+	for _, obj := range list {
+		if key, err := s.keyFunc(obj); err == nil {
+			objects[key] = obj
+		}
+	}
+
+	var deleted []interface{}
+	s.objectsLock.Lock()
+	for key, obj := range s.objects {
+		if _, ok := objects[key]; !ok {
+			deleted = append(deleted, cache.DeletedFinalStateUnknown{Key: key, Obj: obj})
+		}
+	}
+	s.objects = objects
+	s.objectsLock.Unlock()
+
+	for _, obj := range deleted {
+		s.handler.OnDelete(obj)
+	}
+	return nil
+}
+
+// expire notifies the handler of the objects which have been expired since the last call.
+func (s *watcherStore) expire() {
+	expirationHandler, ok := s.handler.(ExpirationHandler)
+
+	var expired []interface{}
+	s.objectsLock.Lock()
+	for key, obj := range s.objects {
+		// getting an expired object removes it from the TTL store
+		if _, exists, err := s.Store.GetByKey(key); err == nil && !exists {
+			delete(s.objects, key)
+			expired = append(expired, obj)
+		}
+	}
+	s.objectsLock.Unlock()
+
+	if ok {
+		for _, obj := range expired {
+			expirationHandler.OnExpire(obj)
+		}
+	}
+}
+
+func (s *watcherStore) track(obj interface{}) {
+	key, err := s.keyFunc(obj)
+	if err != nil {
+		return
+	}
+
+	s.objectsLock.Lock()
+	s.objects[key] = obj
+	s.objectsLock.Unlock()
+}
+
+func (s *watcherStore) untrack(obj interface{}) {
+	key, err := s.keyFunc(obj)
+	if err != nil {
+		return
+	}
+
+	s.objectsLock.Lock()
+	delete(s.objects, key)
+	s.objectsLock.Unlock()
+}
+
 func newWatcherStore(config *WatcherStoreConfig) *watcherStore {
 	return &watcherStore{
 		Store:   cache.NewTTLStore(config.KeyFunc, config.StorageTTL),
+		keyFunc: config.KeyFunc,
 		handler: config.Handler,
+		objects: make(map[string]interface{}),
 	}
 }
@@ -3,9 +3,13 @@ package watchers
 import (
 	"time"
 
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/tools/cache"
 )
 
+// expirationCheckPeriod is the period for finding the objects expired by the storage TTL.
+const expirationCheckPeriod = 1 * time.Minute
+
 // WatcherConfig represents the configuration of the Kubernetes API watcher.
 type WatcherConfig struct {
 	ListerWatcher cache.ListerWatcher
@@ -17,24 +21,37 @@ type WatcherConfig struct {
 // Watcher is an interface of the generic proactive API watcher.
 type Watcher interface {
 	Run(stopCh <-chan struct{})
+
+	// GetStore returns the storage backing the watcher, the objects inside it
+	// must be treated as read-only.
+	GetStore() cache.Store
 }
 
 type watcher struct {
 	reflector *cache.Reflector
+	store     *watcherStore
 }
 
 func (w *watcher) Run(stopCh <-chan struct{}) {
+	go wait.Until(w.store.expire, expirationCheckPeriod, stopCh)
 	w.reflector.Run(stopCh)
 }
 
+func (w *watcher) GetStore() cache.Store {
+	return w.store.Store
+}
+
 // NewWatcher creates a new Kubernetes API watcher using provided configuration.
 func NewWatcher(config *WatcherConfig) Watcher {
+	store := newWatcherStore(config.StoreConfig)
+
 	return &watcher{
 		reflector: cache.NewReflector(
 			config.ListerWatcher,
 			config.ExpectedType,
-			newWatcherStore(config.StoreConfig),
+			store,
 			config.ResyncPeriod,
 		),
+		store: store,
 	}
 }
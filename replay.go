@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/clusters"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/config"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/events/sinks"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/events/sinks/pipes"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/expressions"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/replay"
+	"github.com/thxcode/kubernetes-event-exporter/pkg/utils/logger"
+	"github.com/urfave/cli"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// replayPipeSourcePrefix selects the events stored by a MongoDB pipe as the source.
+const replayPipeSourcePrefix = "pipe:"
+
+var replayCommand = cli.Command{
+	Name:  "replay",
+	Usage: "replay the archived events through the drop rules, the transforms, the classification and the routes into the pipes",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name: "from",
+			Usage: "source of the events, one of a NDJSON file or directory, a http(s) URL of a single NDJSON object, e.g. the pre-signed URL of an archived object, " +
+				"or " + replayPipeSourcePrefix + "<name> for the events stored by the MongoDB pipe, the gzip compressed NDJSON is decompressed. " +
+				"A bucket or a prefix of objects can't be listed, download it into a directory first",
+		},
+		cli.StringFlag{
+			Name:   "config",
+			Usage:  "configuration file of pipes, drop rules, transforms, classification, routes and tenants, the clusters and the limits are ignored",
+			EnvVar: "CONFIG",
+		},
+		cli.StringSliceFlag{
+			Name:  "use-pipe",
+			Usage: "pipes enabled by flags, which are named by their types, see the same flag of the exporter",
+			Value: &cli.StringSlice{},
+		},
+		cli.StringSliceFlag{
+			Name:  "to",
+			Usage: "names of the pipes to replay into, e.g. a new destination, blank means all pipes except the source pipe",
+			Value: &cli.StringSlice{},
+		},
+		cli.StringFlag{
+			Name:  "since",
+			Usage: "replay the events last seen at or after the RFC3339 time, blank means the beginning",
+		},
+		cli.StringFlag{
+			Name:  "until",
+			Usage: "replay the events last seen before the RFC3339 time, blank means the end",
+		},
+		cli.Float64Flag{
+			Name:  "qps",
+			Usage: "maximum events replayed per second, 0 means unlimited",
+			Value: 50,
+		},
+		cli.IntFlag{
+			Name:  "burst",
+			Usage: "maximum burst of the replayed events",
+			Value: 50,
+		},
+		cli.StringFlag{
+			Name:   "kubeconfig",
+			Usage:  "kube config of the cluster which the events belong to, required by the MongoDB pipe and the namespace of the expressions",
+			EnvVar: "KUBECONFIG",
+		},
+		cli.StringFlag{
+			Name:  "kube-context",
+			Usage: "context of the kube config, blank means the current context",
+		},
+		cli.StringFlag{
+			Name:  "cluster-name",
+			Usage: "name of the cluster which the events belong to, the cluster is named by its context by default",
+		},
+		cli.DurationFlag{
+			Name:  "shutdown-timeout",
+			Usage: "deadline for draining the queued events after replaying, the remaining events are dropped",
+			Value: 30 * time.Second,
+		},
+	},
+	Action: replayAction,
+}
+
+// loadReplayCluster loads the cluster from the kube config, or names an offline cluster
+// without the kube config, which only suits the pipes not calling the cluster.
+func loadReplayCluster(kubeconfig, kubeContext, name string) (*clusters.Cluster, error) {
+	if len(kubeconfig) == 0 {
+		if len(name) == 0 {
+			return nil, errors.New("cluster-name is required without kubeconfig")
+		}
+		return &clusters.Cluster{Name: name, Config: &rest.Config{}}, nil
+	}
+
+	options := &clusters.KubeconfigOptions{}
+	if len(kubeContext) != 0 {
+		options.Contexts = []string{kubeContext}
+	}
+	cs, err := clusters.LoadKubeconfig(kubeconfig, options)
+	if err != nil {
+		return nil, err
+	}
+	if len(cs) == 0 {
+		return nil, errors.NotFoundf("cluster of %s", kubeconfig)
+	}
+
+	cluster := cs[0]
+	if len(name) != 0 {
+		cluster.Name = name
+	}
+	return cluster, nil
+}
+
+func newReplaySource(from string, ep *eventExporterPipes, cluster *clusters.Cluster, since, until time.Time) (replay.Source, error) {
+	switch {
+	case strings.HasPrefix(from, replayPipeSourcePrefix):
+		name := strings.TrimPrefix(from, replayPipeSourcePrefix)
+		for _, pipeConfig := range ep.Pipes {
+			if pipeConfig.Name != name {
+				continue
+			}
+			if pipeConfig.Type != "mongodb" {
+				return nil, errors.NotSupportedf("replaying from %s pipe of %s type", name, pipeConfig.Type)
+			}
+			if len(cluster.Config.Host) == 0 {
+				return nil, errors.New("kubeconfig is required to find the events stored by the MongoDB pipe")
+			}
+			return pipes.NewMongoDBSource(cluster.Config.Host, pipeOptions(pipeConfig), since, until), nil
+		}
+		return nil, errors.NotFoundf("pipe %s", name)
+	case strings.HasPrefix(from, "http://"), strings.HasPrefix(from, "https://"):
+		return replay.NewHTTPSource(from), nil
+	case len(from) != 0:
+		return replay.NewFileSource(from), nil
+	}
+
+	return nil, errors.New("from is required")
+}
+
+func parseReplayTime(c *cli.Context, name string) time.Time {
+	value := c.String(name)
+	if len(value) == 0 {
+		return time.Time{}
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		logrus.WithError(err).Fatalf("failed to parse %s", name)
+	}
+	return t
+}
+
+func replayAction(c *cli.Context) {
+	var (
+		from            = c.String("from")
+		configPath      = c.String("config")
+		usePipes        = c.StringSlice("use-pipe")
+		toPipes         = c.StringSlice("to")
+		since           = parseReplayTime(c, "since")
+		until           = parseReplayTime(c, "until")
+		shutdownTimeout = c.Duration("shutdown-timeout")
+
+		stopChan   = newSystemStopChannel()
+		fileConfig *config.Config
+	)
+
+	// the log flags are global
+	initLog(c.Parent())
+
+	if len(configPath) != 0 {
+		var err error
+		fileConfig, err = config.Load(configPath)
+		if err != nil {
+			logrus.WithError(err).Fatalln("failed to load configuration from", configPath)
+		}
+	}
+
+	ep, err := mergePipes(usePipes, fileConfig, nil)
+	if err != nil {
+		logrus.WithError(err).Fatalln("failed to merge pipes")
+	}
+
+	cluster, err := loadReplayCluster(c.String("kubeconfig"), c.String("kube-context"), c.String("cluster-name"))
+	if err != nil {
+		logrus.WithError(err).Fatalln("failed to load cluster")
+	}
+	logContext := logger.CreateLogContext("REPLAY", cluster.Name)
+
+	source, err := newReplaySource(from, ep, cluster, since, until)
+	if err != nil {
+		logrus.WithFields(logContext).WithError(err).Fatalln("failed to create source")
+	}
+
+	kclient, err := kubernetes.NewForConfig(cluster.Config)
+	if err != nil {
+		logrus.WithFields(logContext).WithError(err).Fatalln("failed to create Kubernetes client")
+	}
+	dclient, err := dynamic.NewForConfig(cluster.Config)
+	if err != nil {
+		logrus.WithFields(logContext).WithError(err).Fatalln("failed to create Kubernetes dynamic client")
+	}
+	var enricher expressions.Enricher
+	if len(cluster.Config.Host) != 0 {
+		enricher = expressions.NewNamespaceEnricher(logContext, kclient)
+	}
+
+	// selected records whether each pipe of the to flag is found
+	selected := make(map[string]bool, len(toPipes))
+	for _, name := range toPipes {
+		selected[name] = false
+	}
+	// the source pipe is left out by default, so that the events aren't stored twice
+	sourcePipe := ""
+	if strings.HasPrefix(from, replayPipeSourcePrefix) {
+		sourcePipe = strings.TrimPrefix(from, replayPipeSourcePrefix)
+	}
+	sinkPipes := make(map[string]sinks.Pipe, len(ep.Pipes))
+	for _, pipeConfig := range ep.Pipes {
+		if _, ok := selected[pipeConfig.Name]; !ok && len(toPipes) != 0 {
+			continue
+		}
+		if len(toPipes) == 0 && pipeConfig.Name == sourcePipe {
+			continue
+		}
+		selected[pipeConfig.Name] = true
+
+		pipe, err := createPipe(pipeConfig, cluster, kclient, dclient)
+		if err != nil {
+			logrus.WithFields(logContext).WithError(err).Fatalln("failed to create pipe")
+		}
+		if pipe != nil {
+			sinkPipes[pipeConfig.Name] = pipe
+		}
+	}
+	for name, found := range selected {
+		if !found {
+			logrus.WithFields(logContext).Fatalf("failed to find pipe %s", name)
+		}
+	}
+	if len(sinkPipes) == 0 {
+		logrus.WithFields(logContext).Fatalln("failed to create sink, there aren't any pipes enabled")
+	}
+
+	// the limits are left out, the replay is paced by the qps instead
+	sink, err := sinks.NewDefaultSink(&sinks.DefaultSinkConfig{
+		ClusterName: cluster.Name,
+		Pipes:       sinkPipes,
+		DropRules:   ep.DropRules,
+		Transforms:  ep.Transforms,
+		Classifier:  ep.Classifier,
+		Routes:      ep.Routes,
+		Enricher:    enricher,
+	})
+	if err != nil {
+		logrus.WithFields(logContext).WithError(err).Fatalln("failed to create sink")
+	}
+	if err := sink.Start(); err != nil {
+		logrus.WithFields(logContext).WithError(err).Fatalln("failed to run sink")
+	}
+
+	ctx, cancelFunc := context.WithCancel(context.Background())
+	go func() {
+		<-stopChan
+		cancelFunc()
+	}()
+
+	stats, replayErr := replay.NewReplayer(&replay.ReplayerConfig{
+		Cluster: cluster.Name,
+		Source:  source,
+		Since:   since,
+		Until:   until,
+		QPS:     float32(c.Float64("qps")),
+		Burst:   c.Int("burst"),
+		Handle:  sink.Add,
+	}).Run(ctx)
+	cancelFunc()
+
+	logrus.WithFields(logContext).Debugf("draining pipes within %s", shutdownTimeout)
+	drainCtx, drainCancelFunc := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer drainCancelFunc()
+	dropped := sink.Stop(drainCtx)
+
+	logrus.WithFields(logContext).Infof("read %d events, skipped %d out of the time range, replayed %d, failed %d, dropped %d on draining",
+		stats.Read, stats.Skipped, stats.Replayed, stats.Failed, dropped)
+	if replayErr != nil {
+		logrus.WithFields(logContext).WithError(replayErr).Errorln("failed to replay")
+		os.Exit(1)
+	}
+	if stats.Failed != 0 || dropped != 0 {
+		os.Exit(1)
+	}
+}